@@ -0,0 +1,3 @@
+module github.com/stephanos/mcache
+
+go 1.19
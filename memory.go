@@ -10,9 +10,16 @@ package mcache
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"math/rand"
+	"path"
 	"runtime"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -27,6 +34,14 @@ const (
 	AbsoluteExpiration ExpirationKind = 1
 )
 
+// NoExpiration is the expire time span of cache entry that never expires, like PutP set.
+// Such entries are not tracked by the expiration sweep and report a zero expiration time.
+//
+// Beware that by default any expire less than a microsecond, 0 included, means never expire too,
+// so a computed TTL that reaches 0 makes an entry permanent instead of expiring it right away.
+// WithStrictExpiration make NoExpiration and other negative spans the only ones that never expire
+const NoExpiration time.Duration = -1
+
 const (
 	// _minTickInterval is the min interval duration to run expiration check process
 	_minTickInterval time.Duration = time.Second
@@ -34,21 +49,68 @@ const (
 	// _minExpiration is the min duration of cache entry expiration
 	_minExpiration time.Duration = time.Microsecond
 
-	// _noExpiration means cache entry will not be expirated
-	_noExpiration time.Duration = 1000 * 1000 * time.Hour
+	// _statLimit is the max number of cache entries Stat lists
+	_statLimit = 100
+)
+
+var (
+	// ErrKeyNotFound is returned when the key doesn't exist or is expired
+	ErrKeyNotFound = errors.New("mcache: key not found")
+
+	// ErrNotInteger is returned when an integer operation is applied to a non-integer value
+	ErrNotInteger = errors.New("mcache: value is not an integer")
+
+	// ErrVersionMismatch is returned when the version of cache entry isn't the expected one
+	ErrVersionMismatch = errors.New("mcache: version mismatch")
+
+	// ErrKeyExists is returned when inserting a key that already exists
+	ErrKeyExists = errors.New("mcache: key already exists")
+
+	// ErrValueTooLarge is returned when a value is larger than the max value size
+	ErrValueTooLarge = errors.New("mcache: value too large")
+
+	// ErrClosed is returned when putting into a cache after Close
+	ErrClosed = errors.New("mcache: cache is closed")
 )
 
-// TickInterval is the the interval duration of expiration check
+// Clock is the source of current time used by cache expiration
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock is the wall clock
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// Sizer return the estimated size of a cache value in bytes
+type Sizer func(value interface{}) int64
+
+// TickInterval is the the default interval duration of expiration check,
+// it is read when a cache is created
 var TickInterval time.Duration = time.Minute
 
 // item is cache entry item
 type item struct {
 	Key        string
 	Value      interface{}
-	Version    int
+	Version    int64
 	Kind       ExpirationKind
 	Expiration time.Duration
 	ExpAt      time.Time
+	NoExpire   bool
+	MaxIdle    time.Duration
+	IdleAt     time.Time
+	Meta       map[string]string
+	CreatedAt  time.Time
+	LastAccess time.Time
+
+	size     int64
+	due      time.Time
+	index    int
+	onExpire func(key string, value interface{})
 }
 
 // MCache is cache in memory
@@ -59,29 +121,133 @@ type MCache struct {
 // https://groups.google.com/forum/?fromgroups=#!topic/golang-nuts/1ItNOOj8yW8
 type mcache struct {
 	sync.RWMutex
-	items map[string]*item
-	stop  chan bool
-	tick  <-chan time.Time
+	items   map[string]*item
+	stop    chan bool
+	expire  bool
+	running bool
+	closed  bool
+	halted  bool
+	calls   map[string]*call
+	locks   map[string]*keyLock
+
+	tickInterval time.Duration
+	tickJitter   time.Duration
+	clock        Clock
+	rand         *rand.Rand
+	sweeper      sweeper
+
+	expireHandler func(key string, value interface{}) bool
+
+	loader           func(key string) (interface{}, time.Duration, ExpirationKind, error)
+	encode           func(interface{}) ([]byte, error)
+	decode           func([]byte) (interface{}, error)
+	writeThrough     func(key string, value interface{}) error
+	writeThroughMode WriteThroughMode
+	unwritten        []pendingWrite
+
+	onEvicted func(key string, value interface{}, reason EvictReason)
+	evicted   []eviction
+	subs      []chan Event
+
+	refreshAhead float64
+	maxTTL       time.Duration
+
+	defaultExpire time.Duration
+	defaultKind   ExpirationKind
+	minExpire     time.Duration
+	strictExpire  bool
+	touchThrottle time.Duration
+	statRedactor  func(key string, value interface{}) string
+
+	maxEntries   int
+	maxBytes     int64
+	maxValueSize int64
+	memoryTarget uint64
+	bytes        int64
+	sizer        Sizer
+	copier       func(interface{}) interface{}
+	policy       EvictionPolicy
+	customPolicy bool
+	trackAccess  bool
+	lastAccess   bool
+
+	metrics    MetricsSink
+	unreported int
+	generation atomic.Uint64
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+
+	contention bool
+	readWait   atomic.Int64
+	writeWait  atomic.Int64
+	reads      atomic.Uint64
+	writes     atomic.Uint64
 }
 
-func NewMemoryCache(expire bool) *MCache {
-	cache := &mcache{
-		items: map[string]*item{},
-		stop:  make(chan bool),
-	}
+// EntryInfo is the information of a cache entry, ExpiresAt is zero if the entry never expires
+type EntryInfo struct {
+	Key       string
+	Kind      ExpirationKind
+	ExpiresAt time.Time
+	Version   int64
+	Expired   bool
+}
+
+// Entry is the description of a cache entry Describe return, ExpiresAt is zero if the entry never expires
+type Entry struct {
+	Value     interface{}
+	Version   int64
+	Kind      ExpirationKind
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// CacheStats is the hit/miss statistics of cache
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+// New return a new MCache configured by opts
+func New(opts ...Option) *MCache {
+	cache := newMCache(opts...)
 	c := &MCache{cache}
 
-	if expire {
-		go cache.startTick()
+	if cache.expire {
+		cache.start()
 		runtime.SetFinalizer(c, stopTick)
 	}
 
 	return c
 }
 
-// PutP set a cache entry with very long expiration time
+// NewMemoryCache return a new MCache, expired entries are purged in background if expire is true
+func NewMemoryCache(expire bool) *MCache {
+	return New(withExpiration(expire))
+}
+
+// NewMemoryCacheLRU return a new MCache holding at most maxEntries entries,
+// the least recently used entry is evicted when the cache is full
+func NewMemoryCacheLRU(maxEntries int, expire bool) *MCache {
+	return New(WithMaxEntries(maxEntries), withExpiration(expire))
+}
+
+// NewMemoryCacheWithTick return a new MCache checking expiration every tick instead of TickInterval
+func NewMemoryCacheWithTick(expire bool, tick time.Duration) *MCache {
+	return New(WithTickInterval(tick), withExpiration(expire))
+}
+
+// NewMemoryCacheWithClock return a new MCache reading current time from clock, mostly for tests
+func NewMemoryCacheWithClock(clock Clock, expire bool) *MCache {
+	return New(WithClock(clock), withExpiration(expire))
+}
+
+// PutP set a cache entry that never expires
 func (mc *mcache) PutP(key string, value interface{}) {
-	mc.Put(key, value, 0, AbsoluteExpiration)
+	mc.Put(key, value, NoExpiration, AbsoluteExpiration)
 }
 
 // PutAbs set a cache entry with AbsoluteExpiration
@@ -94,216 +260,1496 @@ func (mc *mcache) PutSlid(key string, value interface{}, expire time.Duration) {
 	mc.Put(key, value, expire, SlidingExpiration)
 }
 
-// Put set a cache entry with expire time span and kind
+// Put set a cache entry with expire time span and kind, a value larger than the max value size set by
+// WithMaxValueSize is silently not stored, use PutE to know it. It panics after Close
 func (mc *mcache) Put(key string, value interface{}, expire time.Duration, kind ExpirationKind) {
+	if mc.PutE(key, value, expire, kind) == ErrClosed {
+		panic(ErrClosed)
+	}
+}
+
+// PutE set a cache entry like Put, it return ErrValueTooLarge if value is larger than the max
+// value size, an existing entry of key is then left as is, and ErrClosed after Close. With
+// WithWriteThrough it return the error of the write through function
+func (mc *mcache) PutE(key string, value interface{}, expire time.Duration, kind ExpirationKind) error {
 	mc.Lock()
-	defer mc.Unlock()
+	if mc.closed {
+		mc.unlock()
+		return ErrClosed
+	}
+	if mc.put(key, value, expire, kind) == nil {
+		mc.unlock()
+		return ErrValueTooLarge
+	}
 
-	mc.put(key, value, expire, kind)
+	return mc.unlockE()
 }
 
-// Get return a cached value, it return false if key doesn't exist
-func (mc *mcache) Get(key string) (interface{}, bool) {
-	x, ok := mc.get(key)
+// PutBytes set a cache entry holding a byte slice, its length counts toward WithMaxBytes
+// without a Sizer. The slice is stored as is, the caller must not modify it afterwards
+func (mc *mcache) PutBytes(key string, value []byte, expire time.Duration, kind ExpirationKind) {
+	mc.Put(key, value, expire, kind)
+}
+
+// GetBytes return a cached byte slice, it return false if key doesn't exist, is expired or
+// doesn't hold a byte slice. The slice is shared with the cache and must not be modified
+func (mc *mcache) GetBytes(key string) ([]byte, bool) {
+	v, ok := mc.Get(key)
 	if !ok {
 		return nil, false
 	}
 
-	x.touch()
-	return x.Value, true
+	b, ok := v.([]byte)
+	return b, ok
 }
 
-// GetV return cached value and it's version
-func (mc *mcache) GetV(key string) (interface{}, int, bool) {
-	x, ok := mc.get(key)
-	if !ok {
-		return nil, 0, false
-	}
+// Set set a cache entry with the default expiration set by WithDefaultExpiration,
+// the entry never expires without it
+func (mc *mcache) Set(key string, value interface{}) {
+	mc.Put(key, value, mc.defaultExpire, mc.defaultKind)
+}
+
+// PutWithMeta set a cache entry with expire time span and kind along with metadata describing it,
+// meta is copied. The metadata is kept when the value is updated and dropped when the entry is put again
+func (mc *mcache) PutWithMeta(key string, value interface{}, meta map[string]string, expire time.Duration, kind ExpirationKind) {
+	mc.Lock()
+	defer mc.unlock()
+	mc.mustOpen()
 
-	x.touch()
-	return x.Value, x.Version, true
+	x := mc.put(key, value, expire, kind)
+	if x != nil && meta != nil {
+		x.Meta = make(map[string]string, len(meta))
+		for k, v := range meta {
+			x.Meta[k] = v
+		}
+	}
 }
 
-// Add insert a cache entry, it return false if key exist
-func (mc *mcache) Add(key string, value interface{}, expire time.Duration, kind ExpirationKind) bool {
+// PutWithCallback set a cache entry with expire time span and kind like Put along with a callback
+// of its own, called like the eviction callback and in addition to it when the entry expires, is
+// deleted or leaves the cache for any other reason, being replaced by a new put included.
+// Updates of the value keep the callback
+func (mc *mcache) PutWithCallback(key string, value interface{}, expire time.Duration, kind ExpirationKind, onExpire func(key string, value interface{})) {
 	mc.Lock()
-	defer mc.Unlock()
+	defer mc.unlock()
+	mc.mustOpen()
 
-	x, ok := mc.items[key]
-	if !ok {
-		mc.put(key, value, expire, kind)
-		return true
+	if x := mc.put(key, value, expire, kind); x != nil {
+		x.onExpire = onExpire
 	}
+}
 
-	if x.Expiration >= _minExpiration && x.expired() {
-		mc.put(key, value, expire, kind)
-		return true
+// PutMulti set some cache entries with the same expire time span and kind in one lock
+func (mc *mcache) PutMulti(entries map[string]interface{}, expire time.Duration, kind ExpirationKind) {
+	mc.Lock()
+	defer mc.unlock()
+	mc.mustOpen()
+
+	for k, v := range entries {
+		mc.put(k, v, expire, kind)
 	}
+}
+
+// PutMultiJittered set some cache entries with kind and an expire time span of base plus a random
+// offset in [0, jitter) each, so entries warmed together don't all expire at the same time
+func (mc *mcache) PutMultiJittered(entries map[string]interface{}, base, jitter time.Duration, kind ExpirationKind) {
+	mc.Lock()
+	defer mc.unlock()
+	mc.mustOpen()
 
-	return false
+	for k, v := range entries {
+		expire := base
+		if jitter > 0 {
+			expire += time.Duration(mc.rand.Int63n(int64(jitter)))
+		}
+		mc.put(k, v, expire, kind)
+	}
 }
 
-// Update update cache entry, it return false if key doesn't exist
-func (mc *mcache) Update(key string, value interface{}) bool {
-	return mc.update(key, -1, value)
+// PutIdle set a cache entry with AbsoluteExpiration which also expires when it is not accessed
+// for maxIdle, whichever comes first, NoExpiration means no absolute deadline
+func (mc *mcache) PutIdle(key string, value interface{}, expire, maxIdle time.Duration) {
+	mc.Lock()
+	defer mc.unlock()
+	mc.mustOpen()
+
+	if x := mc.put(key, value, expire, AbsoluteExpiration); x != nil {
+		x.setMaxIdle(mc.now(), maxIdle)
+		mc.sweeper.schedule(x)
+	}
 }
 
-// UpdateV update cache entry when version match
-func (mc *mcache) UpdateV(key string, version int, value interface{}) bool {
-	return mc.update(key, version, value)
+// Get return a cached value, it return false if key doesn't exist or is expired,
+// an expired entry is removed from the cache when Get finds it. With WithLoader a miss is loaded
+// instead, Get return false if the loader fails.
+// The value is the one stored, not a copy: modifying a slice, map or pointer it holds changes
+// it for every reader, use WithCopyOnGet to get copies
+func (mc *mcache) Get(key string) (interface{}, bool) {
+	v, ok := mc.get(key, true)
+	if !ok {
+		if mc.loader != nil {
+			return mc.loadKey(key)
+		}
+		return nil, false
+	}
+
+	return v.value, true
 }
 
-// Delete delete cache entry from the cache
-func (mc *mcache) Delete(key string) {
-	mc.delete(key)
+// GetOrDefault return a cached value, or def if key doesn't exist or is expired
+func (mc *mcache) GetOrDefault(key string, def interface{}) interface{} {
+	if v, ok := mc.Get(key); ok {
+		return v
+	}
+
+	return def
 }
 
-// DeleteMulti delete some keys from cache
-func (mc *mcache) DeleteMulti(keys []string) {
-	if keys == nil || len(keys) == 0 {
-		return
+// TryGet return a cached value like Get without waiting for the lock, locked is false when the lock
+// is held by a writer and the cache wasn't read, so callers may fall back to the source. It may
+// miss entries under write contention, an expired entry is not removed and sliding expiration is
+// only refreshed when the write lock is free too
+func (mc *mcache) TryGet(key string) (value interface{}, ok bool, locked bool) {
+	if !mc.TryRLock() {
+		return nil, false, false
 	}
+	x, ok := mc.lookup(key)
+	touch := ok && (mc.trackAccess || mc.lastAccess || mc.touchDue(x, mc.now()))
+	if ok {
+		value = x.Value
+	}
+	mc.RUnlock()
 
-	mc.Lock()
-	defer mc.Unlock()
+	if !ok {
+		mc.countMisses(1)
+		return nil, false, true
+	}
 
-	for _, k := range keys {
-		delete(mc.items, k)
+	mc.countHits(1)
+	if touch && mc.TryLock() {
+		mc.accessLocked(x, mc.now())
+		mc.unlock()
 	}
+
+	return mc.copyValue(value), true, true
 }
 
-// Clear deletes everything from the cache
-func (mc *mcache) Clear() {
-	mc.Lock()
-	defer mc.Unlock()
-	mc.items = map[string]*item{}
+// Peek return a cached value like Get without touching it, sliding expiration and idle time are not
+// refreshed and recency is not updated, so monitoring doesn't keep entries alive. It isn't counted
+// in Stats either
+func (mc *mcache) Peek(key string) (interface{}, bool) {
+	mc.RLock()
+	defer mc.RUnlock()
+
+	x, ok := mc.lookup(key)
+	if !ok {
+		return nil, false
+	}
+
+	return mc.valueOf(x), true
 }
 
-// Count return number of cache entry, maybe include expired
-func (mc *mcache) Count() int {
-	mc.Lock()
-	defer mc.Unlock()
+// Age return how long ago cache entry was put, updates and access don't change it, it doesn't touch
+// the entry and return false if key doesn't exist
+func (mc *mcache) Age(key string) (time.Duration, bool) {
+	mc.RLock()
+	defer mc.RUnlock()
 
-	n := len(mc.items)
-	return n
+	x, ok := mc.lookup(key)
+	if !ok {
+		return 0, false
+	}
+
+	return mc.now().Sub(x.CreatedAt), true
 }
 
-// Exists return whether the key exist
-func (mc *mcache) Exists(key string) bool {
-	_, ok := mc.get(key)
-	return ok
+// IdleTime return how long ago cache entry was last read, or put if it never was, it doesn't touch
+// the entry. It return false if key doesn't exist or last access isn't recorded, see WithLastAccess
+func (mc *mcache) IdleTime(key string) (time.Duration, bool) {
+	mc.RLock()
+	defer mc.RUnlock()
+
+	x, ok := mc.lookup(key)
+	if !ok || !mc.lastAccess {
+		return 0, false
+	}
+
+	return mc.now().Sub(x.LastAccess), true
 }
 
-// Keys return all cache keys
-func (mc *mcache) Keys() []string {
+// Describe return the value, version, expiration kind and times of cache entry in one read for
+// introspection, it doesn't touch the entry like Peek and return false if key doesn't exist
+func (mc *mcache) Describe(key string) (Entry, bool) {
 	mc.RLock()
 	defer mc.RUnlock()
 
-	keys := make([]string, 0, 255)
+	x, ok := mc.lookup(key)
+	if !ok {
+		return Entry{}, false
+	}
 
-	for k, v := range mc.items {
-		if !v.expired() {
-			keys = append(keys, k)
+	return Entry{
+		Value:     mc.valueOf(x),
+		Version:   x.Version,
+		Kind:      x.Kind,
+		ExpiresAt: x.expiresAt(),
+		CreatedAt: x.CreatedAt,
+	}, true
+}
+
+// GetStale return a cached value even if it is expired, as long as it hasn't been removed yet,
+// fresh tells whether it is not expired. It lets a stale value be served while it is refreshed,
+// a stale entry is not removed nor touched and counts as a miss
+func (mc *mcache) GetStale(key string) (value interface{}, fresh bool, ok bool) {
+	mc.RLock()
+	x, ok := mc.items[key]
+	if ok {
+		fresh = !x.expirable() || !x.expired(mc.now())
+		value = x.Value
+	}
+	mc.RUnlock()
+
+	if !ok || !fresh {
+		mc.countMisses(1)
+		if !ok {
+			return nil, false, false
 		}
+		return mc.copyValue(value), false, true
 	}
 
-	return keys
+	mc.countHits(1)
+	mc.access(x)
+	return mc.copyValue(value), true, true
 }
 
-// Stat return MCache stat information
-func (mc *mcache) Stat() string {
-	mc.RLock()
-	defer mc.RUnlock()
+// GetWithMeta return a cached value and the metadata set by PutWithMeta, meta is nil without it.
+// The returned meta is shared with the cache and must not be modified
+func (mc *mcache) GetWithMeta(key string) (interface{}, map[string]string, bool) {
+	v, ok := mc.get(key, true)
+	if !ok {
+		return nil, nil, false
+	}
 
-	var buf bytes.Buffer
-	buf.WriteString("start stat \n")
-	buf.WriteString(fmt.Sprintf("Len=%d \n", len(mc.items)))
-	for k, v := range mc.items {
-		buf.WriteString(fmt.Sprintf("key=%s; value=%v; ExpAt=%v; \n", k, v.Value, v.ExpAt))
+	return v.value, v.meta, true
+}
+
+// GetV return cached value and it's version, the version is truncated to int on 32-bit platforms
+// so it may wrap around, use GetV64 and UpdateV64 for the full version
+func (mc *mcache) GetV(key string) (interface{}, int, bool) {
+	v, version, ok := mc.GetV64(key)
+	return v, int(version), ok
+}
+
+// GetV64 return cached value and it's version. The version starts at 0 and grows by one on every
+// update of the entry, it would need 2^63 updates to wrap around
+func (mc *mcache) GetV64(key string) (interface{}, int64, bool) {
+	v, ok := mc.get(key, true)
+	if !ok {
+		return nil, 0, false
 	}
-	buf.WriteString("end stat \n")
-	return buf.String()
+
+	return v.value, v.version, true
 }
 
-func (mc *mcache) update(key string, version int, value interface{}) bool {
-	x, ok := mc.get(key)
+// GetWithExpiry return a cached value and the time it expires at,
+// a zero expiresAt means the entry never expires
+func (mc *mcache) GetWithExpiry(key string) (interface{}, time.Time, bool) {
+	v, ok := mc.get(key, true)
 	if !ok {
-		return false
+		return nil, time.Time{}, false
 	}
 
+	return v.value, v.expiresAt, true
+}
+
+// GetFull return cached value, it's version and the time it expires at,
+// a zero expiresAt means the entry never expires like GetWithExpiry
+func (mc *mcache) GetFull(key string) (interface{}, int, time.Time, bool) {
+	v, ok := mc.get(key, true)
+	if !ok {
+		return nil, 0, time.Time{}, false
+	}
+
+	return v.value, int(v.version), v.expiresAt, true
+}
+
+// GetAndTouch return a cached value and reset its expiration to expire from now atomically.
+// The kind is kept, a sliding entry keeps sliding by expire afterwards
+func (mc *mcache) GetAndTouch(key string, expire time.Duration) (interface{}, bool) {
 	mc.Lock()
-	defer mc.Unlock()
+	defer mc.unlock()
 
-	if version >= 0 && x.Version != version {
-		return false
+	x, ok := mc.lookup(key)
+	if !ok {
+		return nil, false
 	}
 
-	x.Value = value
-	x.Version++
-	x.touch()
+	mc.extend(x, expire)
+	return mc.valueOf(x), true
+}
+
+// Touch reset cache entry expiration to expire from now, it return false if key doesn't exist.
+// Only the deadline changes, the kind is kept and a sliding entry keeps sliding by expire afterwards
+func (mc *mcache) Touch(key string, expire time.Duration) bool {
+	mc.Lock()
+	defer mc.unlock()
+
+	x, ok := mc.lookup(key)
+	if !ok {
+		return false
+	}
 
+	mc.extend(x, expire)
 	return true
 }
 
-// expired return cache entry expired or not
-func (item *item) expired() bool {
-	//return time.Now().UnixNano() > item.ExpAtN
-	return time.Now().After(item.ExpAt)
+// GetMulti return cached values of keys, missing or expired keys are absent from the result.
+// Keys are looked up under one read lock, then found entries are touched like Get does,
+// which takes the write lock once only if recency is tracked
+func (mc *mcache) GetMulti(keys []string) map[string]interface{} {
+	values := make(map[string]interface{}, len(keys))
+	found := make([]*item, 0, len(keys))
+
+	mc.RLock()
+	for _, k := range keys {
+		if x, ok := mc.lookup(k); ok {
+			values[k] = mc.valueOf(x)
+			found = append(found, x)
+		}
+	}
+	mc.RUnlock()
+
+	mc.countHits(len(found))
+	mc.countMisses(len(keys) - len(found))
+
+	mc.access(found...)
+	return values
+}
+
+// Add insert a cache entry, it return false if key exist
+func (mc *mcache) Add(key string, value interface{}, expire time.Duration, kind ExpirationKind) bool {
+	err := mc.AddE(key, value, expire, kind)
+	if err == ErrClosed {
+		panic(err)
+	}
+
+	return err == nil
 }
 
-// touch can refresh cache entry expiration time
-func (item *item) touch() {
-	if item.Kind != SlidingExpiration {
-		return
+// AddE insert a cache entry like Add, it return ErrKeyExists if key exist and ErrClosed after Close
+func (mc *mcache) AddE(key string, value interface{}, expire time.Duration, kind ExpirationKind) error {
+	mc.Lock()
+	defer mc.unlock()
+
+	if mc.closed {
+		return ErrClosed
 	}
 
-	if item.Expiration >= _minExpiration {
-		item.ExpAt = time.Now().Add(item.Expiration)
+	if _, ok := mc.lookup(key); ok {
+		return ErrKeyExists
 	}
+
+	mc.put(key, value, expire, kind)
+	return nil
 }
 
-func (mc *mcache) put(key string, value interface{}, expire time.Duration, kind ExpirationKind) {
-	var expAt time.Time
-	if expire < _minExpiration {
-		expire = 0
-		expAt = time.Now().Add(_noExpiration)
-	} else {
-		expAt = time.Now().Add(expire)
+// LoadOrStore return the existing value of key if it exists like sync.Map does, otherwise it
+// store value with expire time span and kind and return it, loaded is true if the value was loaded.
+// A loaded entry is accessed like Get does
+func (mc *mcache) LoadOrStore(key string, value interface{}, expire time.Duration, kind ExpirationKind) (actual interface{}, loaded bool) {
+	mc.Lock()
+	defer mc.unlock()
+
+	if x, ok := mc.lookup(key); ok {
+		mc.accessLocked(x, mc.now())
+		return mc.valueOf(x), true
 	}
 
-	mc.items[key] = &item{
-		Key:        key,
-		Value:      value,
-		Version:    0,
-		Kind:       kind,
-		Expiration: expire,
-		ExpAt:      expAt,
+	mc.mustOpen()
+	mc.put(key, value, expire, kind)
+	return value, false
+}
+
+// GetOrPut return the cached value of key, or store value with expire time span and kind and
+// return it if key doesn't exist, loaded is true if the value was cached. Unlike LoadOrStore a hit
+// only takes the read lock, unless the entry slides or recency is tracked
+func (mc *mcache) GetOrPut(key string, value interface{}, expire time.Duration, kind ExpirationKind) (actual interface{}, loaded bool) {
+	if v, ok := mc.get(key, true); ok {
+		return v.value, true
 	}
-	return
+
+	return mc.LoadOrStore(key, value, expire, kind)
 }
 
-func (mc *mcache) get(key string) (*item, bool) {
-	mc.RLock()
-	x, ok := mc.items[key]
-	mc.RUnlock()
+// Swap set the value of key and return the previous one like sync.Map does, loaded is false if key
+// didn't exist. An existing entry keeps its expiration, a new one gets the default expiration
+// set by WithDefaultExpiration, use GetAndSet to reset the expiration too. A value larger than the
+// max value size is not stored, an existing entry is kept as is and Swap return nil and false
+func (mc *mcache) Swap(key string, value interface{}) (previous interface{}, loaded bool) {
+	mc.Lock()
+	defer mc.unlock()
 
-	if !ok {
+	if mc.tooLarge(value) {
 		return nil, false
 	}
 
-	if x.Expiration < _minExpiration {
-		return x, ok
+	if x, ok := mc.lookup(key); ok {
+		previous = x.Value
+		mc.setValue(x, value)
+		return previous, true
+	}
+
+	mc.mustOpen()
+	mc.put(key, value, mc.defaultExpire, mc.defaultKind)
+	return nil, false
+}
+
+// PutIf put value with expire time span and kind only if key doesn't exist or less(old, value)
+// return true for its current value old, atomically, so high-water marks only advance.
+// It return whether value was stored, less is called under the write lock so it must not use
+// the cache
+func (mc *mcache) PutIf(key string, value interface{}, less func(old, new interface{}) bool, expire time.Duration, kind ExpirationKind) bool {
+	mc.Lock()
+	defer mc.unlock()
+
+	if x, ok := mc.lookup(key); ok && !less(x.Value, value) {
+		return false
 	}
-	if x.expired() {
-		//mc.delete(key)
+
+	mc.mustOpen()
+	return mc.put(key, value, expire, kind) != nil
+}
+
+// GetAndSet put value with expire time span and kind and return the value it replaced, existed is
+// false if key didn't exist. Unlike Swap the entry always gets the fresh expiration and kind like
+// Put, the old expiration is not kept. A value larger than the max value size is not stored, an
+// existing entry is kept as is and GetAndSet return nil and false like Swap
+func (mc *mcache) GetAndSet(key string, value interface{}, expire time.Duration, kind ExpirationKind) (old interface{}, existed bool) {
+	mc.Lock()
+	defer mc.unlock()
+	mc.mustOpen()
+
+	if mc.tooLarge(value) {
 		return nil, false
 	}
 
-	return x, ok
+	if x, ok := mc.lookup(key); ok {
+		old, existed = mc.valueOf(x), true
+	}
+
+	mc.put(key, value, expire, kind)
+	return old, existed
 }
 
-func (mc *mcache) delete(key string) {
+// Update update cache entry, it return false if key doesn't exist
+func (mc *mcache) Update(key string, value interface{}) bool {
+	return mc.update(key, nil, value) == nil
+}
+
+// UpdateE update cache entry like Update, it return ErrKeyNotFound if key doesn't exist
+func (mc *mcache) UpdateE(key string, value interface{}) error {
+	return mc.update(key, nil, value)
+}
+
+// UpdateV update cache entry when version match, the version is compared in the int form GetV returns
+func (mc *mcache) UpdateV(key string, version int, value interface{}) bool {
+	return mc.UpdateVE(key, version, value) == nil
+}
+
+// UpdateVE update cache entry when version match like UpdateV, it return ErrKeyNotFound if key
+// doesn't exist or is expired and ErrVersionMismatch if the version doesn't match
+func (mc *mcache) UpdateVE(key string, version int, value interface{}) error {
+	return mc.update(key, func(v int64) bool { return int(v) == version }, value)
+}
+
+// UpdateV64 update cache entry when version match
+func (mc *mcache) UpdateV64(key string, version int64, value interface{}) bool {
+	return mc.update(key, func(v int64) bool { return v == version }, value) == nil
+}
+
+// Replace update cache entry value and reset its expiration, it return false if key doesn't exist
+// or value is larger than the max value size
+func (mc *mcache) Replace(key string, value interface{}, expire time.Duration, kind ExpirationKind) bool {
 	mc.Lock()
-	defer mc.Unlock()
-	delete(mc.items, key)
+	defer mc.unlock()
+
+	x, ok := mc.lookup(key)
+	if !ok || mc.tooLarge(value) {
+		return false
+	}
+
+	x.Kind = kind
+	x.setExpiration(mc.now(), mc.ttl(expire))
+	mc.sweeper.schedule(x)
+	mc.setValue(x, value)
+	return true
+}
+
+// SetKind change the expiration kind of cache entry and reset its expiration to expire from now,
+// keeping its value and version, like turning an absolute session sliding after login.
+// It return false if key doesn't exist
+func (mc *mcache) SetKind(key string, kind ExpirationKind, expire time.Duration) bool {
+	mc.Lock()
+	defer mc.unlock()
+
+	x, ok := mc.lookup(key)
+	if !ok {
+		return false
+	}
+
+	x.Kind = kind
+	mc.extend(x, expire)
+	return true
+}
+
+// UpdateExp update cache entry value and reset its expiration to expire from now keeping its kind,
+// it return false if key doesn't exist or value is larger than the max value size
+func (mc *mcache) UpdateExp(key string, value interface{}, expire time.Duration) bool {
+	mc.Lock()
+	defer mc.unlock()
+
+	x, ok := mc.lookup(key)
+	if !ok || mc.tooLarge(value) {
+		return false
+	}
+
+	x.setExpiration(mc.now(), mc.ttl(expire))
+	mc.sweeper.schedule(x)
+	mc.setValue(x, value)
+	return true
+}
+
+// Rename move cache entry from oldKey to newKey keeping its value, version and expiration,
+// it return false if oldKey doesn't exist. An entry already stored under newKey is overwritten
+// and reported to the eviction callback as replaced, the moved entry isn't reported
+func (mc *mcache) Rename(oldKey, newKey string) bool {
+	mc.Lock()
+	defer mc.unlock()
+
+	x, ok := mc.lookup(oldKey)
+	if !ok {
+		return false
+	}
+	if oldKey == newKey {
+		return true
+	}
+
+	if old, ok := mc.items[newKey]; ok {
+		mc.remove(newKey, old, EvictReasonReplaced)
+	}
+
+	delete(mc.items, oldKey)
+	x.Key = newKey
+	mc.items[newKey] = x
+	mc.queueWrite(x)
+	if mc.policy != nil {
+		mc.policy.OnRemove(oldKey)
+		mc.policy.OnInsert(newKey)
+	}
+
+	mc.publish(EventDelete, oldKey)
+	mc.publish(EventPut, newKey)
+	return true
+}
+
+// Delete delete cache entry from the cache
+func (mc *mcache) Delete(key string) {
+	mc.delete(key)
+}
+
+// DeleteV delete cache entry when version match, it return false if key doesn't exist or version mismatch.
+// The version is compared in the int form GetV returns
+func (mc *mcache) DeleteV(key string, version int) bool {
+	return mc.deleteIf(key, func(x *item) bool { return int(x.Version) == version })
+}
+
+// DeleteV64 delete cache entry when version match, it return false if key doesn't exist or version mismatch
+func (mc *mcache) DeleteV64(key string, version int64) bool {
+	return mc.deleteIf(key, func(x *item) bool { return x.Version == version })
+}
+
+// DeleteIf delete cache entry when pred accept its value and return whether it was deleted,
+// pred is called under the write lock so it must not use the cache
+func (mc *mcache) DeleteIf(key string, pred func(value interface{}) bool) bool {
+	return mc.deleteIf(key, func(x *item) bool { return pred(x.Value) })
+}
+
+// GetAndDelete return a cached value and delete it atomically, it return false if key doesn't exist
+func (mc *mcache) GetAndDelete(key string) (interface{}, bool) {
+	mc.Lock()
+	defer mc.unlock()
+
+	x, ok := mc.lookup(key)
+	if !ok {
+		return nil, false
+	}
+
+	mc.remove(key, x, EvictReasonDeleted)
+	return x.Value, true
+}
+
+// DeleteMulti delete some keys from cache
+func (mc *mcache) DeleteMulti(keys []string) {
+	mc.deleteMulti(keys, EvictReasonDeleted)
+}
+
+// DeleteMultiR delete some keys from cache like DeleteMulti under one lock and return the values
+// of the removed entries, missing and expired keys are absent from the result. Expired entries
+// are reported to the eviction callback as expired, not deleted
+func (mc *mcache) DeleteMultiR(keys []string) map[string]interface{} {
+	values := make(map[string]interface{}, len(keys))
+	if len(keys) == 0 {
+		return values
+	}
+
+	mc.Lock()
+	defer mc.unlock()
+
+	now := mc.now()
+	for _, k := range keys {
+		x, ok := mc.items[k]
+		if !ok {
+			continue
+		}
+
+		if x.expired(now) {
+			mc.remove(k, x, EvictReasonExpired)
+			mc.countEvictions(1)
+			continue
+		}
+
+		values[k] = x.Value
+		mc.remove(k, x, EvictReasonDeleted)
+	}
+
+	return values
+}
+
+// Clear deletes everything from the cache
+func (mc *mcache) Clear() {
+	mc.Lock()
+	defer mc.unlock()
+
+	mc.clear()
+}
+
+// ReplaceAll replace the whole cache content with entries set with the same expire time span and kind
+// under one write lock, so readers see either the old or the new content and never a partial one.
+// Previous entries are reported to the eviction callback as cleared
+func (mc *mcache) ReplaceAll(entries map[string]interface{}, expire time.Duration, kind ExpirationKind) {
+	mc.Lock()
+	defer mc.unlock()
+	mc.mustOpen()
+
+	mc.clear()
+	for k, v := range entries {
+		mc.put(k, v, expire, kind)
+	}
+}
+
+// clear deletes everything from the cache, the eviction callback is queued for every entry
+// and runs once the lock is released, caller must hold the lock
+func (mc *mcache) clear() {
+	for k, x := range mc.items {
+		if mc.onEvicted != nil || x.onExpire != nil {
+			mc.evicted = append(mc.evicted, eviction{k, x.Value, EvictReasonCleared, x.onExpire})
+		}
+	}
+	mc.generation.Add(1)
+	if len(mc.subs) > 0 {
+		for k := range mc.items {
+			mc.publish(EventDelete, k)
+		}
+	}
+
+	if mc.policy != nil {
+		for k := range mc.items {
+			mc.policy.OnRemove(k)
+		}
+	}
+
+	mc.items = map[string]*item{}
+	mc.bytes = 0
+	mc.sweeper.reset()
+}
+
+// Count return number of cache entry, maybe include expired entries not removed yet.
+// It is cheap, use CountValid for the number of entries Keys would return
+func (mc *mcache) Count() int {
+	mc.Lock()
+	defer mc.unlock()
+
+	n := len(mc.items)
+	return n
+}
+
+// CountValid return number of not expired cache entry, it walks all entries
+func (mc *mcache) CountValid() int {
+	mc.RLock()
+	defer mc.RUnlock()
+
+	n, now := 0, mc.now()
+	for _, v := range mc.items {
+		if !v.expired(now) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Capacity return max number of cache entry, 0 means unlimited
+func (mc *mcache) Capacity() int {
+	return mc.maxEntries
+}
+
+// Bytes return the estimated size of all cache entries by the Sizer
+func (mc *mcache) Bytes() int64 {
+	mc.RLock()
+	defer mc.RUnlock()
+
+	return mc.bytes
+}
+
+// Exists return whether the key exist
+func (mc *mcache) Exists(key string) bool {
+	_, ok := mc.get(key, false)
+	return ok
+}
+
+// ExistsMulti return whether each of keys exist, it takes the read lock once for all keys
+// and doesn't touch the entries
+func (mc *mcache) ExistsMulti(keys []string) map[string]bool {
+	mc.RLock()
+	defer mc.RUnlock()
+
+	exists := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		_, exists[k] = mc.lookup(k)
+	}
+
+	return exists
+}
+
+// Keys return all cache keys
+func (mc *mcache) Keys() []string {
+	mc.RLock()
+	defer mc.RUnlock()
+
+	keys := make([]string, 0, 255)
+
+	now := mc.now()
+	for k, v := range mc.items {
+		if !v.expired(now) {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys
+}
+
+// Items return a copy of all not expired cache entries, it is safe to keep and iterate without
+// holding any lock. The copy is shallow, values that are pointers, maps or slices are shared
+// with the cache unless they are copied by WithCopyOnGet
+func (mc *mcache) Items() map[string]interface{} {
+	mc.RLock()
+	defer mc.RUnlock()
+
+	items := make(map[string]interface{}, len(mc.items))
+
+	now := mc.now()
+	for k, v := range mc.items {
+		if !v.expired(now) {
+			items[k] = mc.valueOf(v)
+		}
+	}
+
+	return items
+}
+
+// KeysChan return a channel yielding all cache keys, it is closed after the last key or when ctx
+// is done. Keys are snapshotted under the read lock first, so writers are not blocked while the
+// caller consumes the channel and a key may be gone by the time it is received
+func (mc *mcache) KeysChan(ctx context.Context) <-chan string {
+	keys := mc.Keys()
+	ch := make(chan string)
+
+	go func() {
+		defer close(ch)
+		for _, k := range keys {
+			select {
+			case ch <- k:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+// SortedKeys return all cache keys in lexical order, it is slower than Keys
+func (mc *mcache) SortedKeys() []string {
+	keys := mc.Keys()
+	sort.Strings(keys)
+	return keys
+}
+
+// KeysWithPrefix return all cache keys starting with prefix
+func (mc *mcache) KeysWithPrefix(prefix string) []string {
+	mc.RLock()
+	defer mc.RUnlock()
+
+	keys := make([]string, 0, 255)
+
+	now := mc.now()
+	for k, v := range mc.items {
+		if strings.HasPrefix(k, prefix) && !v.expired(now) {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys
+}
+
+// DeletePrefix delete cache entries whose keys start with prefix and return the number deleted,
+// keys are collected under the read lock so the write lock is only held for deletion
+func (mc *mcache) DeletePrefix(prefix string) int {
+	return mc.deleteMulti(mc.KeysWithPrefix(prefix), EvictReasonDeleted)
+}
+
+// DeleteMatch delete cache entries whose keys match pattern with path.Match semantics, like
+// session:*:temp, and return the number deleted. Keys are collected under the read lock so the
+// write lock is only held for deletion, a malformed pattern deletes nothing and return path.ErrBadPattern
+func (mc *mcache) DeleteMatch(pattern string) (int, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return 0, err
+	}
+
+	mc.RLock()
+	keys := make([]string, 0, 255)
+
+	now := mc.now()
+	for k, v := range mc.items {
+		if ok, _ := path.Match(pattern, k); ok && !v.expired(now) {
+			keys = append(keys, k)
+		}
+	}
+	mc.RUnlock()
+
+	return mc.deleteMulti(keys, EvictReasonDeleted), nil
+}
+
+// Range call fn for each not expired cache entry until fn return false, it doesn't refresh
+// sliding expiration. The read lock is held during iteration, so fn must not modify the cache
+// or it will deadlock, use Keys for a snapshot instead
+func (mc *mcache) Range(fn func(key string, value interface{}) bool) {
+	mc.RLock()
+	defer mc.RUnlock()
+
+	now := mc.now()
+	for k, v := range mc.items {
+		if v.expired(now) {
+			continue
+		}
+		if !fn(k, mc.valueOf(v)) {
+			return
+		}
+	}
+}
+
+// Stat return MCache stat information, it lists at most _statLimit entries, see StatN
+func (mc *mcache) Stat() string {
+	return mc.StatN(_statLimit)
+}
+
+// StatN return MCache stat information listing at most limit entries, in no particular order.
+// Values are printed with %v unless a redactor is set by WithStatRedactor
+func (mc *mcache) StatN(limit int) string {
+	mc.RLock()
+	defer mc.RUnlock()
+
+	var buf bytes.Buffer
+	buf.WriteString("start stat \n")
+	buf.WriteString(fmt.Sprintf("Len=%d \n", len(mc.items)))
+	now, n := mc.now(), 0
+	for k, v := range mc.items {
+		if n >= limit {
+			buf.WriteString(fmt.Sprintf("... %d more \n", len(mc.items)-n))
+			break
+		}
+		n++
+
+		info := v.info(k, now)
+		value := fmt.Sprintf("%v", v.Value)
+		if mc.statRedactor != nil {
+			value = mc.statRedactor(k, v.Value)
+		}
+		buf.WriteString(fmt.Sprintf("key=%s; value=%s; ExpAt=%v; \n", info.Key, value, info.ExpiresAt))
+	}
+	buf.WriteString("end stat \n")
+	return buf.String()
+}
+
+// Snapshot return information of all cache entries, including expired ones not removed yet.
+// Values are left out so it is cheap enough for monitoring
+func (mc *mcache) Snapshot() []EntryInfo {
+	mc.RLock()
+	defer mc.RUnlock()
+
+	infos := make([]EntryInfo, 0, len(mc.items))
+	now := mc.now()
+	for k, v := range mc.items {
+		infos = append(infos, v.info(k, now))
+	}
+
+	return infos
+}
+
+// NextExpiration return the key and deadline of the not expired cache entry expiring soonest,
+// entries that never expire are skipped and ok is false if there is none. It is O(1) when the
+// entry on top of the expiration heap is up to date and scans all entries otherwise
+func (mc *mcache) NextExpiration() (key string, at time.Time, ok bool) {
+	mc.RLock()
+	defer mc.RUnlock()
+
+	now := mc.now()
+	if s, isHeap := mc.sweeper.(*heapSweep); isHeap && len(s.h) > 0 {
+		x := s.h[0]
+		if mc.items[x.Key] == x && !x.expired(now) && x.due.Equal(x.expiresAt()) {
+			return x.Key, x.due, true
+		}
+	}
+
+	for k, x := range mc.items {
+		if !x.expirable() || x.expired(now) {
+			continue
+		}
+
+		if exp := x.expiresAt(); !ok || exp.Before(at) {
+			key, at, ok = k, exp, true
+		}
+	}
+
+	return key, at, ok
+}
+
+// Generation return a number that changes whenever cache entries are put, updated, deleted,
+// cleared or expire, a caller can compare it with an earlier one to know whether anything changed
+func (mc *mcache) Generation() uint64 {
+	return mc.generation.Load()
+}
+
+// Stats return hit/miss statistics since the cache was created or ResetStats was called
+func (mc *mcache) Stats() CacheStats {
+	return CacheStats{
+		Hits:      mc.hits.Load(),
+		Misses:    mc.misses.Load(),
+		Evictions: mc.evictions.Load(),
+	}
+}
+
+// ResetStats reset hit/miss statistics to zero
+func (mc *mcache) ResetStats() {
+	mc.hits.Store(0)
+	mc.misses.Store(0)
+	mc.evictions.Store(0)
+}
+
+// update set cache entry value if its version is accepted by match, a nil match accepts any version
+func (mc *mcache) update(key string, match func(version int64) bool, value interface{}) error {
+	var err error
+
+	mc.Lock()
+	x, ok := mc.lookup(key)
+	switch {
+	case !ok:
+		err = ErrKeyNotFound
+	case match != nil && !match(x.Version):
+		err = ErrVersionMismatch
+	case mc.tooLarge(value):
+		err = ErrValueTooLarge
+	default:
+		mc.setValue(x, value)
+		return mc.unlockE()
+	}
+	mc.unlock()
+
+	return err
+}
+
+// extend reset cache entry expiration to expire from now keeping its kind, caller must hold the lock
+func (mc *mcache) extend(x *item, expire time.Duration) {
+	now := mc.now()
+	x.setExpiration(now, mc.ttl(expire))
+	x.touch(now)
+	mc.sweeper.schedule(x)
+	mc.promote(x)
+}
+
+// setValue replace the value of cache entry and bump its version, caller must hold the lock
+func (mc *mcache) setValue(x *item, value interface{}) {
+	size := mc.sizeOf(value)
+	mc.bytes += size - x.size
+
+	x.Value = value
+	x.Version++
+	x.size = size
+	x.touch(mc.now())
+	mc.sweeper.touched(x)
+	mc.publish(EventUpdate, x.Key)
+	mc.queueWrite(x)
+
+	if mc.policy != nil {
+		mc.promote(x)
+		mc.evict()
+	}
+}
+
+// expired return cache entry expired or not, an entry that never expires is only expired by max idle time
+func (item *item) expired(now time.Time) bool {
+	return (!item.NoExpire && now.After(item.ExpAt)) || (item.MaxIdle > 0 && now.After(item.IdleAt))
+}
+
+// expirable return whether cache entry has an expiration or a max idle time
+func (item *item) expirable() bool {
+	return !item.NoExpire || item.MaxIdle > 0
+}
+
+// info return the information of cache entry stored under key
+func (item *item) info(key string, now time.Time) EntryInfo {
+	return EntryInfo{
+		Key:       key,
+		Kind:      item.Kind,
+		ExpiresAt: item.expiresAt(),
+		Version:   item.Version,
+		Expired:   item.expired(now),
+	}
+}
+
+// setExpiration reset cache entry expiration time, NoExpiration or any expire less than
+// _minExpiration means never expire and leaves ExpAt zero
+func (item *item) setExpiration(now time.Time, expire time.Duration) {
+	if expire < _minExpiration {
+		item.Expiration = 0
+		item.ExpAt = time.Time{}
+		item.NoExpire = true
+	} else {
+		item.Expiration = expire
+		item.ExpAt = now.Add(expire)
+		item.NoExpire = false
+	}
+}
+
+// setMaxIdle set the max idle time of cache entry, it expires when not accessed for maxIdle
+// even before its expiration time, maxIdle less than _minExpiration means no max idle time
+func (item *item) setMaxIdle(now time.Time, maxIdle time.Duration) {
+	if maxIdle < _minExpiration {
+		item.MaxIdle = 0
+		item.IdleAt = time.Time{}
+	} else {
+		item.MaxIdle = maxIdle
+		item.IdleAt = now.Add(maxIdle)
+	}
+}
+
+// expiresAt return the time cache entry expires at unless accessed, it is zero if the entry never expires
+func (item *item) expiresAt() time.Time {
+	if item.MaxIdle > 0 && (item.NoExpire || item.IdleAt.Before(item.ExpAt)) {
+		return item.IdleAt
+	}
+
+	return item.ExpAt
+}
+
+// touchable return whether touch would change cache entry
+func (item *item) touchable() bool {
+	return item.MaxIdle > 0 || (item.Kind == SlidingExpiration && !item.NoExpire)
+}
+
+// touch can refresh cache entry expiration time and idle time
+func (item *item) touch(now time.Time) {
+	if item.MaxIdle > 0 {
+		item.IdleAt = now.Add(item.MaxIdle)
+	}
+
+	if item.Kind != SlidingExpiration {
+		return
+	}
+
+	if !item.NoExpire {
+		item.ExpAt = now.Add(item.Expiration)
+	}
+}
+
+// put set a cache entry and return it, it return nil and leaves the cache as is if value is
+// larger than the max value size, caller must hold the lock
+func (mc *mcache) put(key string, value interface{}, expire time.Duration, kind ExpirationKind) *item {
+	size := mc.sizeOf(value)
+	if mc.maxValueSize > 0 && size > mc.maxValueSize {
+		return nil
+	}
+
+	now := mc.now()
+	x := &item{
+		Key:       key,
+		Value:     value,
+		Version:   0,
+		Kind:      kind,
+		CreatedAt: now,
+		size:      size,
+		index:     -1,
+	}
+	if mc.lastAccess {
+		x.LastAccess = now
+	}
+	x.setExpiration(now, mc.ttl(expire))
+
+	if old, ok := mc.items[key]; ok {
+		mc.remove(key, old, EvictReasonReplaced)
+	}
+	mc.items[key] = x
+	mc.bytes += x.size
+	mc.sweeper.schedule(x)
+	mc.publish(EventPut, key)
+	mc.queueWrite(x)
+
+	if mc.policy != nil {
+		mc.policy.OnInsert(key)
+		mc.evict()
+	}
+
+	return x
+}
+
+// ttl return expire raised to the min expiration set by WithMinExpiration and clamped to the max TTL
+// set by WithMaxTTL, which never expiring entries get too. With WithStrictExpiration an expire in
+// [0, _minExpiration) expires as soon as possible instead of never
+func (mc *mcache) ttl(expire time.Duration) time.Duration {
+	if mc.strictExpire && expire >= 0 && expire < _minExpiration {
+		expire = _minExpiration
+	}
+
+	if expire >= _minExpiration && expire < mc.minExpire {
+		expire = mc.minExpire
+	}
+
+	if mc.maxTTL > 0 && (expire < _minExpiration || expire > mc.maxTTL) {
+		return mc.maxTTL
+	}
+
+	return expire
+}
+
+// valueOf return the value of cache entry for a reader, a copy made by the copier set by
+// WithCopyOnGet if any
+func (mc *mcache) valueOf(x *item) interface{} {
+	return mc.copyValue(x.Value)
+}
+
+// copyValue return v copied by the copier set by WithCopyOnGet, v itself without it
+func (mc *mcache) copyValue(v interface{}) interface{} {
+	if mc.copier == nil {
+		return v
+	}
+
+	return mc.copier(v)
+}
+
+// tooLarge return whether value is larger than the max value size set by WithMaxValueSize
+func (mc *mcache) tooLarge(value interface{}) bool {
+	return mc.maxValueSize > 0 && mc.sizeOf(value) > mc.maxValueSize
+}
+
+// sizeOf return the estimated size of value by the Sizer, without a Sizer it is the length
+// of a []byte value and 0 for other values
+func (mc *mcache) sizeOf(value interface{}) int64 {
+	if mc.sizer == nil {
+		if b, ok := value.([]byte); ok {
+			return int64(len(b))
+		}
+		return 0
+	}
+
+	return mc.sizer(value)
+}
+
+// now return current time of cache clock
+func (mc *mcache) now() time.Time {
+	return mc.clock.Now()
+}
+
+func newMCache(opts ...Option) *mcache {
+	mc := &mcache{
+		items: map[string]*item{},
+		stop:  make(chan bool),
+		calls: map[string]*call{},
+		locks: map[string]*keyLock{},
+
+		tickInterval: TickInterval,
+		clock:        realClock{},
+		rand:         rand.New(rand.NewSource(time.Now().UnixNano())),
+		sweeper:      &heapSweep{},
+		metrics:      nopMetrics{},
+
+		defaultExpire: NoExpiration,
+	}
+
+	for _, opt := range opts {
+		opt(mc)
+	}
+
+	return mc
+}
+
+// view is a cache entry as it was read under the lock, it stays consistent once the lock is released
+type view struct {
+	item      *item
+	value     interface{}
+	version   int64
+	expiresAt time.Time
+	meta      map[string]string
+}
+
+// view return the current state of cache entry, caller must hold the lock
+func (item *item) view() view {
+	return view{item, item.Value, item.Version, item.expiresAt(), item.Meta}
+}
+
+// get return a view of a not expired cache entry, an expired entry it finds is removed from the cache
+// right away instead of waiting for the expiration goroutine. If touch is true the entry is accessed
+// like Get does, under the write lock only if it slides or recency is tracked, and the view is
+// taken after it. The value of the view is copied by the copier
+func (mc *mcache) get(key string, touch bool) (view, bool) {
+	mc.RLock()
+	now := mc.now()
+	x, ok := mc.items[key]
+	expired := ok && x.expirable() && x.expired(now)
+	touch = touch && ok && !expired && (mc.trackAccess || mc.lastAccess || mc.touchDue(x, now))
+	var v view
+	if ok && !expired && !touch {
+		v = x.view()
+	}
+	mc.RUnlock()
+
+	if !ok {
+		mc.countMisses(1)
+		return view{}, false
+	}
+
+	if expired {
+		mc.countMisses(1)
+		if mc.expireHandler == nil {
+			mc.purge(key, x)
+		}
+		return view{}, false
+	}
+
+	mc.countHits(1)
+	if touch {
+		mc.Lock()
+		mc.accessLocked(x, mc.now())
+		v = x.view()
+		mc.unlock()
+	}
+
+	v.value = mc.copyValue(v.value)
+	return v, true
+}
+
+// lookup return a not expired cache entry, caller must hold the lock
+func (mc *mcache) lookup(key string) (*item, bool) {
+	x, ok := mc.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	if x.expirable() && x.expired(mc.now()) {
+		return nil, false
+	}
+
+	return x, true
+}
+
+// purge remove an expired cache entry unless it was replaced since get found it
+func (mc *mcache) purge(key string, x *item) {
+	mc.Lock()
+	defer mc.unlock()
+
+	if mc.items[key] == x {
+		mc.remove(key, x, EvictReasonExpired)
+		mc.countEvictions(1)
+	}
+}
+
+func (mc *mcache) delete(key string) {
+	mc.Lock()
+	defer mc.unlock()
+
+	if x, ok := mc.items[key]; ok {
+		mc.remove(key, x, EvictReasonDeleted)
+	}
+}
+
+// deleteIf delete a not expired cache entry accepted by match and return whether it was deleted
+func (mc *mcache) deleteIf(key string, match func(x *item) bool) bool {
+	mc.Lock()
+	defer mc.unlock()
+
+	x, ok := mc.lookup(key)
+	if !ok || !match(x) {
+		return false
+	}
+
+	mc.remove(key, x, EvictReasonDeleted)
+	return true
+}
+
+func (mc *mcache) deleteMulti(keys []string, reason EvictReason) (n int) {
+	if keys == nil || len(keys) == 0 {
+		return
+	}
+
+	mc.Lock()
+	defer mc.unlock()
+
+	for _, k := range keys {
+		if x, ok := mc.items[k]; ok {
+			mc.remove(k, x, reason)
+			n++
+		}
+	}
+
+	return
+}
+
+// remove delete cache entry from items and recency list and queue the eviction callback,
+// caller must hold the lock
+func (mc *mcache) remove(key string, x *item, reason EvictReason) {
+	delete(mc.items, key)
+	mc.bytes -= x.size
+	mc.sweeper.unschedule(x)
+
+	if mc.policy != nil {
+		mc.policy.OnRemove(key)
+	}
+
+	if mc.onEvicted != nil || x.onExpire != nil {
+		mc.evicted = append(mc.evicted, eviction{key, x.Value, reason, x.onExpire})
+	}
+
+	switch reason {
+	case EvictReasonExpired:
+		mc.publish(EventExpire, key)
+	case EvictReasonReplaced:
+		// the put replacing it publish the change
+	default:
+		mc.publish(EventDelete, key)
+	}
+}
+
+// access refresh cache entries expiration and mark them as recently used under the write lock,
+// which is only taken if an entry slides, has a max idle time or recency is tracked
+func (mc *mcache) access(xs ...*item) {
+	if len(xs) == 0 {
+		return
+	}
+
+	if !mc.trackAccess && !mc.lastAccess {
+		mc.RLock()
+		touch, now := false, mc.now()
+		for _, x := range xs {
+			touch = touch || mc.touchDue(x, now)
+		}
+		mc.RUnlock()
+
+		if !touch {
+			return
+		}
+	}
+
+	mc.Lock()
+	now := mc.now()
+	for _, x := range xs {
+		mc.accessLocked(x, now)
+	}
+	mc.unlock()
+}
+
+// touchDue return whether an access should touch cache entry, with WithSlidingTouchThrottle
+// only if it was last touched at least the throttle ago, caller must hold the lock
+func (mc *mcache) touchDue(x *item, now time.Time) bool {
+	if !x.touchable() {
+		return false
+	}
+
+	if mc.touchThrottle <= 0 {
+		return true
+	}
+
+	if x.MaxIdle > 0 && now.Sub(x.IdleAt.Add(-x.MaxIdle)) >= mc.touchThrottle {
+		return true
+	}
+
+	return x.Kind == SlidingExpiration && !x.NoExpire && now.Sub(x.ExpAt.Add(-x.Expiration)) >= mc.touchThrottle
+}
+
+// accessLocked refresh cache entry expiration, record its last access and mark it as recently used,
+// caller must hold the lock
+func (mc *mcache) accessLocked(x *item, now time.Time) {
+	x.touch(now)
+	mc.sweeper.touched(x)
+	if mc.lastAccess {
+		x.LastAccess = now
+	}
+	mc.promote(x)
+}
+
+// promote report an access of cache entry to the eviction policy, caller must hold the lock
+func (mc *mcache) promote(x *item) {
+	if mc.trackAccess && mc.items[x.Key] == x {
+		mc.policy.OnAccess(x.Key)
+	}
+}
+
+// evict drop expired entries first unless they go to the expire handler, then the ones the eviction
+// policy choose until cache fits maxEntries and maxBytes, one entry is always kept, caller must hold the lock
+func (mc *mcache) evict() {
+	if !mc.overflow() {
+		return
+	}
+
+	if mc.expireHandler == nil {
+		mc.removeExpired()
+	}
+
+	for mc.overflow() && len(mc.items) > 1 {
+		if !mc.evictVictim() {
+			return
+		}
+	}
+}
+
+// evictVictim remove the cache entry the eviction policy choose and return whether there was one,
+// caller must hold the lock
+func (mc *mcache) evictVictim() bool {
+	key, ok := mc.policy.Victim()
+	if !ok {
+		return false
+	}
+
+	x, ok := mc.items[key]
+	if !ok {
+		return false
+	}
+
+	mc.remove(key, x, EvictReasonCapacity)
+	mc.countEvictions(1)
+	return true
+}
+
+// overflow return whether cache exceeds maxEntries or maxBytes, caller must hold the lock
+func (mc *mcache) overflow() bool {
+	return (mc.maxEntries > 0 && len(mc.items) > mc.maxEntries) ||
+		(mc.maxBytes > 0 && mc.bytes > mc.maxBytes)
 }
@@ -0,0 +1,181 @@
+// Copyright 2013 by sdm. All rights reserved.
+
+package mcache
+
+import (
+	"runtime"
+	"unsafe"
+)
+
+// Clone return a new independent cache holding a copy of all not expired cache entries, keeping
+// their version, expiration and metadata, so it can be changed and discarded without affecting
+// this cache. Values are shared references unless a copier is set by WithCopyOnGet.
+// The clone has the same clock, tick interval, limits, expiration defaults, sizer, copier and
+// codec, and runs the goroutine of expire if this cache does. The eviction callback, callbacks of
+// entries, expire handler, loader, write through, metrics sink, subscribers and statistics are not
+// copied, opts can add them. A custom EvictionPolicy is replaced by the least recently used one
+// unless opts set another
+func (mc *mcache) Clone(opts ...Option) *MCache {
+	mc.RLock()
+	clone := newMCache(append([]Option{mc.settings()}, opts...)...)
+	clone.Lock()
+
+	now := mc.now()
+	for _, k := range mc.order() {
+		x := mc.items[k]
+		if x.expired(now) {
+			continue
+		}
+
+		clone.insert(k, x, mc.valueOf(x))
+	}
+	mc.RUnlock()
+
+	if clone.policy != nil {
+		clone.evict()
+	}
+	clone.unlock()
+
+	c := &MCache{clone}
+	if clone.expire {
+		clone.start()
+		runtime.SetFinalizer(c, stopTick)
+	}
+
+	return c
+}
+
+// Merge copy all not expired cache entries of other into this cache keeping their version, expiration
+// and metadata. When a key exists in both, the value onConflict return from this cache's value a and
+// other's value b is stored keeping this cache's expiration, a nil onConflict keeps the existing
+// entry as is. a and b are copied by the copier of their cache set by WithCopyOnGet. Both caches
+// are locked during the merge, in a fixed order so concurrent merges of the same caches in opposite
+// directions don't deadlock, onConflict is called under these locks so it must not use either cache
+func (mc *mcache) Merge(other *MCache, onConflict func(key string, a, b interface{}) interface{}) {
+	mc.merge(other.mcache, func(key string, x, y *item) {
+		if onConflict == nil {
+			return
+		}
+
+		v := onConflict(key, mc.valueOf(x), other.valueOf(y))
+		if !mc.tooLarge(v) {
+			mc.setValue(x, v)
+		}
+	})
+}
+
+// MergeLatest copy all not expired cache entries of other into this cache like Merge, when a key
+// exists in both the entry expiring later is kept, an entry that never expires is the latest
+func (mc *mcache) MergeLatest(other *MCache) {
+	mc.merge(other.mcache, func(key string, x, y *item) {
+		if !x.NoExpire && (y.NoExpire || y.expiresAt().After(x.expiresAt())) {
+			mc.insert(key, y, other.valueOf(y))
+		}
+	})
+}
+
+// merge copy not expired cache entries of other missing from this cache and pass the others to
+// conflict with both entries, this cache is write locked and other read locked by address order
+func (mc *mcache) merge(other *mcache, conflict func(key string, x, y *item)) {
+	if other == mc {
+		return
+	}
+
+	if uintptr(unsafe.Pointer(mc)) < uintptr(unsafe.Pointer(other)) {
+		mc.Lock()
+		other.RLock()
+	} else {
+		other.RLock()
+		mc.Lock()
+	}
+	defer mc.unlock()
+	defer other.RUnlock()
+	mc.mustOpen()
+
+	now := other.now()
+	for k, y := range other.items {
+		if y.expired(now) {
+			continue
+		}
+
+		if x, ok := mc.lookup(k); ok {
+			conflict(k, x, y)
+		} else {
+			mc.insert(k, y, other.valueOf(y))
+		}
+	}
+
+	if mc.policy != nil {
+		mc.evict()
+	}
+}
+
+// insert store a copy of cache entry x of another cache under key with value, keeping its version,
+// expiration and metadata. A value larger than the max value size is not stored, caller must hold the lock
+func (mc *mcache) insert(key string, x *item, value interface{}) {
+	size := mc.sizeOf(value)
+	if mc.maxValueSize > 0 && size > mc.maxValueSize {
+		return
+	}
+
+	y := *x
+	y.Value, y.size, y.index, y.onExpire = value, size, -1, nil
+	if old, ok := mc.items[key]; ok {
+		mc.remove(key, old, EvictReasonReplaced)
+	}
+	mc.items[key] = &y
+	mc.bytes += y.size
+	mc.sweeper.schedule(&y)
+	mc.publish(EventPut, key)
+
+	if mc.policy != nil {
+		mc.policy.OnInsert(key)
+	}
+}
+
+// settings return an Option copying the configuration of this cache which holds no state nor
+// callbacks, caller must hold the lock
+func (mc *mcache) settings() Option {
+	return func(c *mcache) {
+		c.expire = mc.expire
+		c.tickInterval, c.tickJitter, c.clock = mc.tickInterval, mc.tickJitter, mc.clock
+		switch mc.sweeper.(type) {
+		case linearSweep:
+			c.sweeper = linearSweep{}
+		case *wheelSweep:
+			c.sweeper = newWheelSweep()
+		}
+
+		c.refreshAhead, c.maxTTL = mc.refreshAhead, mc.maxTTL
+		c.defaultExpire, c.defaultKind = mc.defaultExpire, mc.defaultKind
+		c.minExpire, c.strictExpire, c.touchThrottle = mc.minExpire, mc.strictExpire, mc.touchThrottle
+		c.maxEntries, c.maxBytes, c.maxValueSize = mc.maxEntries, mc.maxBytes, mc.maxValueSize
+		c.memoryTarget = mc.memoryTarget
+		c.sizer, c.copier, c.lastAccess = mc.sizer, mc.copier, mc.lastAccess
+		c.encode, c.decode = mc.encode, mc.decode
+		c.contention, c.statRedactor = mc.contention, mc.statRedactor
+
+		switch mc.policy.(type) {
+		case nil:
+		case *fifoPolicy:
+			c.policy, c.trackAccess = NewFIFOPolicy(), false
+		default:
+			c.trackRecency()
+		}
+	}
+}
+
+// order return all cache keys, from the next victim to the last one when the eviction policy is
+// one of the built-in policies, caller must hold the lock
+func (mc *mcache) order() []string {
+	if p, ok := mc.policy.(interface{ keys() []string }); ok {
+		return p.keys()
+	}
+
+	keys := make([]string, 0, len(mc.items))
+	for k := range mc.items {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
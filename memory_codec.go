@@ -0,0 +1,43 @@
+// Copyright 2013 by sdm. All rights reserved.
+
+package mcache
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// PutEncoded encode value with the codec set by WithCodec, encoding/json without it, and store
+// the bytes like PutBytes, so the cache holds compact bytes instead of the value. It return the
+// error of the encoder or PutE
+func (mc *mcache) PutEncoded(key string, value interface{}, expire time.Duration, kind ExpirationKind) error {
+	encode := mc.encode
+	if encode == nil {
+		encode = json.Marshal
+	}
+
+	b, err := encode(value)
+	if err != nil {
+		return err
+	}
+
+	return mc.PutE(key, b, expire, kind)
+}
+
+// GetDecoded return the value stored by PutEncoded decoded with the codec set by WithCodec,
+// encoding/json without it. It return ErrKeyNotFound if key doesn't exist, is expired or doesn't
+// hold bytes. Every call decodes again, trading CPU for memory, decoded values are not shared
+func (mc *mcache) GetDecoded(key string) (interface{}, error) {
+	b, ok := mc.GetBytes(key)
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+
+	if mc.decode == nil {
+		var v interface{}
+		err := json.Unmarshal(b, &v)
+		return v, err
+	}
+
+	return mc.decode(b)
+}
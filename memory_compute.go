@@ -0,0 +1,259 @@
+// Copyright 2013 by sdm. All rights reserved.
+
+package mcache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// errComputePanic is returned to waiters whose compute function panicked
+var errComputePanic = errors.New("mcache: compute function panicked")
+
+// call is an in-flight or completed compute of a cache entry, its result is cached with expire and kind
+type call struct {
+	done     chan struct{}
+	val      interface{}
+	err      error
+	panicked interface{}
+	expire   time.Duration
+	kind     ExpirationKind
+}
+
+// GetOrCompute return a cached value, on a miss fn is called once for all concurrent callers
+// of the same key and its result is cached, nothing is cached if fn returns an error
+func (mc *mcache) GetOrCompute(key string, expire time.Duration, kind ExpirationKind, fn func() (interface{}, error)) (interface{}, error) {
+	return mc.GetOrComputeCtx(context.Background(), key, expire, kind, func(context.Context) (interface{}, error) {
+		return fn()
+	})
+}
+
+// GetOrComputeCtx is GetOrCompute with a context, fn runs in its own goroutine with a background
+// context no caller owns. Every caller, the one starting the compute too, return ctx.Err() when
+// its ctx is done before fn returns, the compute still completes and its result is cached for the
+// others. A panic of fn is raised again in every caller waiting for it.
+// With WithRefreshAhead, a hit on an entry close to its expiration also starts fn in the background
+// and return the current value without waiting for it
+func (mc *mcache) GetOrComputeCtx(ctx context.Context, key string, expire time.Duration, kind ExpirationKind, fn func(context.Context) (interface{}, error)) (interface{}, error) {
+	if v, ok := mc.get(key, true); ok {
+		if mc.refreshAhead > 0 {
+			mc.refresh(key, expire, kind, fn)
+		}
+		return v.value, nil
+	}
+
+	mc.Lock()
+	if x, ok := mc.lookup(key); ok {
+		mc.accessLocked(x, mc.now())
+		v := mc.valueOf(x)
+		mc.unlock()
+		return v, nil
+	}
+
+	if c, ok := mc.calls[key]; ok {
+		mc.unlock()
+		select {
+		case <-c.done:
+			return mc.result(c)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	c := &call{done: make(chan struct{}), err: errComputePanic, expire: expire, kind: kind}
+	mc.calls[key] = c
+	mc.unlock()
+
+	go mc.compute(context.Background(), key, c, fn)
+	select {
+	case <-c.done:
+		return mc.result(c)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// refresh start fn in the background for a cache entry whose remaining time to live is below
+// the refresh ahead fraction of its expiration, unless a compute of key is already in flight
+func (mc *mcache) refresh(key string, expire time.Duration, kind ExpirationKind, fn func(context.Context) (interface{}, error)) {
+	mc.RLock()
+	due := mc.refreshDue(key)
+	mc.RUnlock()
+	if !due {
+		return
+	}
+
+	mc.Lock()
+	if _, ok := mc.calls[key]; ok || !mc.refreshDue(key) {
+		mc.unlock()
+		return
+	}
+
+	c := &call{done: make(chan struct{}), err: errComputePanic, expire: expire, kind: kind}
+	mc.calls[key] = c
+	mc.unlock()
+
+	go mc.compute(context.Background(), key, c, fn)
+}
+
+// refreshDue return whether cache entry of key should be refreshed ahead, caller must hold the lock
+func (mc *mcache) refreshDue(key string) bool {
+	x, ok := mc.lookup(key)
+	if !ok || x.NoExpire {
+		return false
+	}
+
+	ahead := time.Duration(mc.refreshAhead * float64(x.Expiration))
+	return x.ExpAt.Sub(mc.now()) < ahead
+}
+
+// loadKey return the value of key from the loader set by WithLoader, a single call of the loader
+// is shared by concurrent callers of the same key and its result is cached
+func (mc *mcache) loadKey(key string) (interface{}, bool) {
+	mc.Lock()
+	if x, ok := mc.lookup(key); ok {
+		mc.accessLocked(x, mc.now())
+		v := mc.valueOf(x)
+		mc.unlock()
+		return v, true
+	}
+
+	if c, ok := mc.calls[key]; ok {
+		mc.unlock()
+		<-c.done
+		v, err := mc.result(c)
+		return v, err == nil
+	}
+
+	c := &call{done: make(chan struct{}), err: errComputePanic}
+	mc.calls[key] = c
+	mc.unlock()
+
+	mc.compute(context.Background(), key, c, func(context.Context) (interface{}, error) {
+		v, expire, kind, err := mc.loader(key)
+		c.expire, c.kind = expire, kind
+		return v, err
+	})
+	v, err := mc.result(c)
+	return v, err == nil
+}
+
+// result return the copied value and the error of completed call c, a panic of its function is
+// raised again
+func (mc *mcache) result(c *call) (interface{}, error) {
+	if c.panicked != nil {
+		panic(c.panicked)
+	}
+
+	return mc.copyValue(c.val), c.err
+}
+
+// compute run fn for the in-flight call c, store the result and release the waiters. A panic of
+// fn is recovered into c.panicked for result to raise it again in the waiters
+func (mc *mcache) compute(ctx context.Context, key string, c *call, fn func(context.Context) (interface{}, error)) {
+	defer func() {
+		c.panicked = recover()
+		mc.Lock()
+		delete(mc.calls, key)
+		if c.err == nil && !mc.closed {
+			mc.put(key, c.val, c.expire, c.kind)
+		}
+		mc.unlock()
+
+		close(c.done)
+	}()
+
+	c.val, c.err = fn(ctx)
+}
+
+// GetOrLoadMulti return cached values of keys, the missing ones are passed to loader in one call
+// and the values it return are cached with expire time span and kind. Keys already being loaded or
+// computed by other callers are waited for instead of loaded again. Keys loader doesn't return are
+// absent from the result, if loader fails the cached values are returned with its error
+func (mc *mcache) GetOrLoadMulti(keys []string, loader func(missing []string) (map[string]interface{}, error), expire time.Duration, kind ExpirationKind) (map[string]interface{}, error) {
+	values := mc.GetMulti(keys)
+	if len(values) == len(keys) {
+		return values, nil
+	}
+
+	var missing []string
+	owned := map[string]*call{}
+	waiting := map[string]*call{}
+
+	mc.Lock()
+	for _, k := range keys {
+		if _, ok := values[k]; ok {
+			continue
+		}
+		if _, ok := owned[k]; ok {
+			continue
+		}
+
+		if x, ok := mc.lookup(k); ok {
+			values[k] = mc.valueOf(x)
+		} else if c, ok := mc.calls[k]; ok {
+			waiting[k] = c
+		} else {
+			c := &call{done: make(chan struct{}), err: errComputePanic}
+			mc.calls[k] = c
+			owned[k] = c
+			missing = append(missing, k)
+		}
+	}
+	mc.unlock()
+
+	var err error
+	if len(missing) > 0 {
+		err = mc.loadMulti(missing, owned, loader, expire, kind)
+	}
+
+	for k, c := range owned {
+		if c.err == nil {
+			values[k] = mc.copyValue(c.val)
+		}
+	}
+
+	for k, c := range waiting {
+		<-c.done
+		if v, e := mc.result(c); e == nil {
+			values[k] = v
+		} else if e != ErrKeyNotFound && err == nil {
+			err = e
+		}
+	}
+
+	return values, err
+}
+
+// loadMulti run loader for the in-flight calls of missing keys, store the results and release the
+// waiters, keys loader doesn't return complete with ErrKeyNotFound
+func (mc *mcache) loadMulti(missing []string, calls map[string]*call, loader func(missing []string) (map[string]interface{}, error), expire time.Duration, kind ExpirationKind) error {
+	defer func() {
+		mc.Lock()
+		for k, c := range calls {
+			delete(mc.calls, k)
+			if c.err == nil && !mc.closed {
+				mc.put(k, c.val, expire, kind)
+			}
+		}
+		mc.unlock()
+
+		for _, c := range calls {
+			close(c.done)
+		}
+	}()
+
+	loaded, err := loader(missing)
+	for k, c := range calls {
+		if err != nil {
+			c.err = err
+		} else if v, ok := loaded[k]; ok {
+			c.val, c.err = v, nil
+		} else {
+			c.err = ErrKeyNotFound
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,259 @@
+package mcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetOrCompute(t *testing.T) {
+	cache := NewMemoryCache(true)
+
+	var calls int32
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			v, err := cache.GetOrCompute("a", time.Minute, AbsoluteExpiration, func() (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				time.Sleep(10 * time.Millisecond)
+				return 1, nil
+			})
+			assetEqual(t, "GetOrCompute Error", nil, err)
+			assetEqual(t, "GetOrCompute Error", 1, v)
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	assetEqual(t, "GetOrCompute Error: calls", int32(1), atomic.LoadInt32(&calls))
+	assetGet(t, cache, "a", 1)
+
+	errFail := errors.New("fail")
+	_, err := cache.GetOrCompute("b", time.Minute, AbsoluteExpiration, func() (interface{}, error) {
+		return nil, errFail
+	})
+	assetEqual(t, "GetOrCompute Error", errFail, err)
+	assetEqual(t, "Exists Error: b", false, cache.Exists("b"))
+}
+
+func TestGetOrComputeCtx(t *testing.T) {
+	cache := NewMemoryCache(true)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		v, err := cache.GetOrComputeCtx(context.Background(), "a", time.Minute, AbsoluteExpiration, func(context.Context) (interface{}, error) {
+			close(started)
+			<-release
+			return 1, nil
+		})
+		assetEqual(t, "GetOrComputeCtx Error", nil, err)
+		assetEqual(t, "GetOrComputeCtx Error", 1, v)
+	}()
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := cache.GetOrComputeCtx(ctx, "a", time.Minute, AbsoluteExpiration, func(context.Context) (interface{}, error) {
+		t.Error("GetOrComputeCtx Error, compute should be in flight")
+		return nil, nil
+	})
+	assetEqual(t, "GetOrComputeCtx Error", context.Canceled, err)
+
+	close(release)
+	<-done
+	assetGet(t, cache, "a", 1)
+}
+
+func TestGetOrComputeCtxStarterCancel(t *testing.T) {
+	cache := NewMemoryCache(true)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := cache.GetOrComputeCtx(ctx, "a", time.Minute, AbsoluteExpiration, func(ctx context.Context) (interface{}, error) {
+			close(started)
+			<-release
+			return 1, ctx.Err()
+		})
+		assetEqual(t, "GetOrComputeCtx Error: starter", context.Canceled, err)
+	}()
+	<-started
+	cancel()
+	<-done
+
+	waited := make(chan struct{})
+	go func() {
+		defer close(waited)
+		v, err := cache.GetOrComputeCtx(context.Background(), "a", time.Minute, AbsoluteExpiration, func(context.Context) (interface{}, error) {
+			t.Error("GetOrComputeCtx Error, compute should be in flight")
+			return nil, nil
+		})
+		assetEqual(t, "GetOrComputeCtx Error: waiter", nil, err)
+		assetEqual(t, "GetOrComputeCtx Error: waiter", 1, v)
+	}()
+
+	close(release)
+	<-waited
+	assetGet(t, cache, "a", 1)
+
+	defer func() {
+		assetEqual(t, "GetOrComputeCtx Error: panic", "boom", recover())
+	}()
+	cache.GetOrCompute("b", time.Minute, AbsoluteExpiration, func() (interface{}, error) {
+		panic("boom")
+	})
+}
+
+func TestGetOrComputeCtxPanicAfterCancel(t *testing.T) {
+	cache := NewMemoryCache(false)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := cache.GetOrComputeCtx(ctx, "a", time.Minute, AbsoluteExpiration, func(context.Context) (interface{}, error) {
+		close(started)
+		<-release
+		panic("boom")
+	})
+	assetEqual(t, "GetOrComputeCtx Error: starter", context.Canceled, err)
+	<-started
+
+	recovered := make(chan interface{})
+	go func() {
+		defer func() { recovered <- recover() }()
+		cache.GetOrComputeCtx(context.Background(), "a", time.Minute, AbsoluteExpiration, nil)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	assetEqual(t, "GetOrComputeCtx Error: waiter", "boom", <-recovered)
+	assetEqual(t, "Exists Error: a", false, cache.Exists("a"))
+}
+
+func TestRefreshAhead(t *testing.T) {
+	clock := NewFakeClock()
+	cache := New(WithClock(clock), WithRefreshAhead(0.5))
+
+	var calls int32
+	fn := func() (interface{}, error) {
+		return int(atomic.AddInt32(&calls, 1)), nil
+	}
+
+	v, _ := cache.GetOrCompute("a", time.Minute, AbsoluteExpiration, fn)
+	assetEqual(t, "GetOrCompute Error", 1, v)
+
+	clock.Advance(20 * time.Second)
+	v, _ = cache.GetOrCompute("a", time.Minute, AbsoluteExpiration, fn)
+	assetEqual(t, "GetOrCompute Error", 1, v)
+	assetEqual(t, "GetOrCompute Error: calls", int32(1), atomic.LoadInt32(&calls))
+
+	clock.Advance(20 * time.Second)
+	v, _ = cache.GetOrCompute("a", time.Minute, AbsoluteExpiration, fn)
+	assetEqual(t, "GetOrCompute Error", 1, v)
+
+	for i := 0; i < 100; i++ {
+		if v, _ := cache.Get("a"); v == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	assetGet(t, cache, "a", 2)
+	assetEqual(t, "GetOrCompute Error: calls", int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestGetOrLoadMulti(t *testing.T) {
+	cache := NewMemoryCache(false)
+	cache.PutP("a", 1)
+
+	var mu sync.Mutex
+	loads := map[string]int{}
+	started := make(chan struct{})
+	loader := func(missing []string) (map[string]interface{}, error) {
+		mu.Lock()
+		for _, k := range missing {
+			loads[k]++
+		}
+		mu.Unlock()
+
+		if len(missing) == 2 {
+			close(started)
+			time.Sleep(10 * time.Millisecond)
+		}
+		return map[string]interface{}{"b": 2, "c": 3}, nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		values, err := cache.GetOrLoadMulti([]string{"a", "b", "c"}, loader, time.Minute, AbsoluteExpiration)
+		assetEqual(t, "GetOrLoadMulti Error", nil, err)
+		assetEqual(t, "GetOrLoadMulti Error", 3, len(values))
+	}()
+
+	<-started
+	values, err := cache.GetOrLoadMulti([]string{"b", "d"}, loader, time.Minute, AbsoluteExpiration)
+	<-done
+
+	assetEqual(t, "GetOrLoadMulti Error", nil, err)
+	assetEqual(t, "GetOrLoadMulti Error", 1, len(values))
+	assetEqual(t, "GetOrLoadMulti Error: b", 2, values["b"])
+	assetEqual(t, "GetOrLoadMulti Error: b", 1, loads["b"])
+	assetEqual(t, "GetOrLoadMulti Error: d", 1, loads["d"])
+	assetGet(t, cache, "c", 3)
+	assetEqual(t, "Exists Error: d", false, cache.Exists("d"))
+
+	errFail := errors.New("fail")
+	_, err = cache.GetOrLoadMulti([]string{"e"}, func([]string) (map[string]interface{}, error) {
+		return nil, errFail
+	}, time.Minute, AbsoluteExpiration)
+	assetEqual(t, "GetOrLoadMulti Error", errFail, err)
+}
+
+func TestWithLoader(t *testing.T) {
+	var calls int32
+	cache := New(WithLoader(func(key string) (interface{}, time.Duration, ExpirationKind, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(10 * time.Millisecond)
+		if key == "bad" {
+			return nil, 0, AbsoluteExpiration, errors.New("fail")
+		}
+		return key + "!", time.Minute, SlidingExpiration, nil
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, ok := cache.Get("a")
+			assetEqual(t, "Get Error: a", true, ok)
+			assetEqual(t, "Get Error: a", "a!", v)
+		}()
+	}
+	wg.Wait()
+	assetEqual(t, "Loader Error: calls", int32(1), atomic.LoadInt32(&calls))
+
+	e, _ := cache.Describe("a")
+	assetEqual(t, "Loader Error: kind", SlidingExpiration, e.Kind)
+
+	_, ok := cache.Get("bad")
+	assetEqual(t, "Get Error: bad", false, ok)
+	assetEqual(t, "Exists Error: bad", false, cache.Exists("bad"))
+
+	_, ok = cache.Peek("b")
+	assetEqual(t, "Peek Error: b", false, ok)
+}
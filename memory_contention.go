@@ -0,0 +1,66 @@
+// Copyright 2013 by sdm. All rights reserved.
+
+package mcache
+
+import "time"
+
+// Lock lock the cache for writing, with WithContentionTracking the time spent waiting is recorded
+func (mc *mcache) Lock() {
+	if !mc.contention {
+		mc.RWMutex.Lock()
+		return
+	}
+
+	mc.writes.Add(1)
+	if mc.RWMutex.TryLock() {
+		return
+	}
+
+	start := time.Now()
+	mc.RWMutex.Lock()
+	mc.writeWait.Add(int64(time.Since(start)))
+}
+
+// RLock lock the cache for reading, with WithContentionTracking the time spent waiting is recorded
+func (mc *mcache) RLock() {
+	if !mc.contention {
+		mc.RWMutex.RLock()
+		return
+	}
+
+	mc.reads.Add(1)
+	if mc.RWMutex.TryRLock() {
+		return
+	}
+
+	start := time.Now()
+	mc.RWMutex.RLock()
+	mc.readWait.Add(int64(time.Since(start)))
+}
+
+// TryLock try to lock the cache for writing without waiting, with WithContentionTracking it is
+// counted when it succeeds
+func (mc *mcache) TryLock() bool {
+	ok := mc.RWMutex.TryLock()
+	if ok && mc.contention {
+		mc.writes.Add(1)
+	}
+	return ok
+}
+
+// TryRLock try to lock the cache for reading without waiting, with WithContentionTracking it is
+// counted when it succeeds
+func (mc *mcache) TryRLock() bool {
+	ok := mc.RWMutex.TryRLock()
+	if ok && mc.contention {
+		mc.reads.Add(1)
+	}
+	return ok
+}
+
+// LockStats return the total time spent waiting for the read and write lock and the number of
+// times each was taken, they are only recorded with WithContentionTracking. A wait that is large
+// compared to the count hints that a ShardedCache would scale better
+func (mc *mcache) LockStats() (readWait, writeWait time.Duration, reads, writes uint64) {
+	return time.Duration(mc.readWait.Load()), time.Duration(mc.writeWait.Load()), mc.reads.Load(), mc.writes.Load()
+}
@@ -0,0 +1,82 @@
+// Copyright 2013 by sdm. All rights reserved.
+
+package mcache
+
+// EventOp is the kind of change of a cache entry
+type EventOp int
+
+const (
+	// EventPut means cache entry was set by Put and the like
+	EventPut EventOp = iota
+
+	// EventUpdate means the value of an existing cache entry was updated
+	EventUpdate
+
+	// EventDelete means cache entry was removed other than by expiration
+	EventDelete
+
+	// EventExpire means cache entry was removed because it expired
+	EventExpire
+)
+
+// _eventBuffer is the buffer size of subscription channels
+const _eventBuffer = 64
+
+// String return the name of event op
+func (op EventOp) String() string {
+	switch op {
+	case EventPut:
+		return "put"
+	case EventUpdate:
+		return "update"
+	case EventDelete:
+		return "delete"
+	case EventExpire:
+		return "expire"
+	}
+	return "unknown"
+}
+
+// Event is a change of a cache entry
+type Event struct {
+	Op  EventOp
+	Key string
+}
+
+// Subscribe return a channel receiving an Event for every change of the cache. Events are sent
+// without blocking while the cache is locked, so they are in order but a subscriber that falls
+// more than a buffer behind loses events instead of stalling the cache
+func (mc *mcache) Subscribe() <-chan Event {
+	mc.Lock()
+	defer mc.unlock()
+
+	ch := make(chan Event, _eventBuffer)
+	mc.subs = append(mc.subs, ch)
+	return ch
+}
+
+// Unsubscribe stop sending events to ch and close it, it does nothing if ch isn't subscribed
+func (mc *mcache) Unsubscribe(ch <-chan Event) {
+	mc.Lock()
+	defer mc.unlock()
+
+	for i, sub := range mc.subs {
+		if sub == ch {
+			mc.subs = append(mc.subs[:i], mc.subs[i+1:]...)
+			close(sub)
+			return
+		}
+	}
+}
+
+// publish record a change of cache entry, it bump the generation and send an event to subscribers,
+// dropping it for subscribers whose buffer is full, caller must hold the lock
+func (mc *mcache) publish(op EventOp, key string) {
+	mc.generation.Add(1)
+	for _, sub := range mc.subs {
+		select {
+		case sub <- Event{op, key}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2013 by sdm. All rights reserved.
+
+package mcache
+
+// EvictReason is the reason a cache entry left the cache
+type EvictReason int
+
+const (
+	// EvictReasonExpired means cache entry was removed because it expired
+	EvictReasonExpired EvictReason = iota
+
+	// EvictReasonDeleted means cache entry was removed by Delete, DeleteMulti and the like
+	EvictReasonDeleted
+
+	// EvictReasonReplaced means cache entry was overwritten by a new entry with the same key
+	EvictReasonReplaced
+
+	// EvictReasonCapacity means cache entry was evicted to make room for a new one
+	EvictReasonCapacity
+
+	// EvictReasonCleared means cache entry was removed by Clear
+	EvictReasonCleared
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictReasonExpired:
+		return "expired"
+	case EvictReasonDeleted:
+		return "deleted"
+	case EvictReasonReplaced:
+		return "replaced"
+	case EvictReasonCapacity:
+		return "capacity"
+	case EvictReasonCleared:
+		return "cleared"
+	}
+	return "unknown"
+}
+
+// eviction is a removed cache entry waiting for the eviction callback and its own callback
+type eviction struct {
+	key      string
+	value    interface{}
+	reason   EvictReason
+	onExpire func(key string, value interface{})
+}
+
+// OnEvicted set a callback called when cache entry leaves the cache, it is called
+// after the lock is released so it may use the cache
+func (mc *mcache) OnEvicted(fn func(key string, value interface{}, reason EvictReason)) {
+	mc.Lock()
+	defer mc.unlock()
+
+	mc.onEvicted = fn
+}
+
+// unlock release the write lock, then report the cache size and evictions, pass the entries
+// stored while it was held to the write through function and call the eviction callback and the
+// callbacks of entries removed meanwhile
+func (mc *mcache) unlock() {
+	mc.unlockE()
+}
+
+// unlockE release the write lock like unlock, it return the first error of the write through function
+func (mc *mcache) unlockE() (err error) {
+	evicted, unwritten, fn := mc.evicted, mc.unwritten, mc.onEvicted
+	n, evictions := len(mc.items), mc.unreported
+	mc.evicted, mc.unwritten, mc.unreported = nil, nil, 0
+	mc.Unlock()
+
+	mc.metrics.SetSize(n)
+	if evictions > 0 {
+		mc.metrics.AddEvictions(evictions)
+	}
+	for _, w := range unwritten {
+		if e := mc.write(w.key, w.x, w.version, w.value); err == nil {
+			err = e
+		}
+	}
+	for _, e := range evicted {
+		if fn != nil {
+			fn(e.key, e.value, e.reason)
+		}
+		if e.onExpire != nil {
+			e.onExpire(e.key, e.value)
+		}
+	}
+
+	return err
+}
@@ -2,52 +2,200 @@
 
 package mcache
 
-import "time"
+import (
+	"runtime"
+	"time"
+)
+
+// start run the goroutine of expire, it is marked running before it is scheduled
+// so close always knows whether there is a goroutine to stop
+func (mc *mcache) start() {
+	mc.running = true
+	go mc.startTick()
+}
 
 // startTick start a goroutine to check expire checking
 func (mc *mcache) startTick() {
 	if mc == nil {
 		return
 	}
+	defer mc.stopped()
 
-	interval := TickInterval
-	if interval < _minTickInterval {
-		interval = _minTickInterval
-	}
+	timer := time.NewTimer(mc.nextTick())
+	defer timer.Stop()
 
-	mc.tick = time.Tick(interval)
 	for {
 		select {
-		case <-mc.tick:
+		case <-timer.C:
 			mc.recycle()
+			mc.relievePressure()
+			timer.Reset(mc.nextTick())
 		case <-mc.stop:
 			return
 		}
 	}
 }
 
-func (mc *mcache) recycle() {
-	keys := mc.expKeys()
-	mc.DeleteMulti(keys)
-}
+// nextTick return the duration until the next expiration check, it is the tick interval unless
+// the sweeper knows an entry expiring sooner, plus a random tick jitter, and never less than
+// _minTickInterval
+func (mc *mcache) nextTick() time.Duration {
+	interval := mc.tickInterval
+	if interval < _minTickInterval {
+		interval = _minTickInterval
+	}
 
-func (mc *mcache) expKeys() (keys []string) {
-	mc.RLock()
-	defer mc.RUnlock()
+	mc.Lock()
+	defer mc.unlock()
 
-	for k, v := range mc.items {
-		if v.expired() {
-			if keys == nil {
-				keys = make([]string, 0, 255)
+	if at, ok := mc.sweeper.next(); ok {
+		if d := at.Sub(mc.now()); d < interval {
+			interval = d
+			if interval < _minTickInterval {
+				interval = _minTickInterval
 			}
-			keys = append(keys, k)
 		}
 	}
 
-	return
+	if mc.tickJitter > 0 {
+		interval += time.Duration(mc.rand.Int63n(int64(mc.tickJitter)))
+	}
+
+	return interval
+}
+
+// Recycle remove expired cache entries now, it lets caches created without the goroutine
+// of expire be swept on demand
+func (mc *mcache) Recycle() {
+	mc.recycle()
+}
+
+// DeleteExpired remove expired cache entries now like Recycle and return the number removed
+func (mc *mcache) DeleteExpired() int {
+	return mc.recycle()
+}
+
+// recycle remove expired cache entries under the write lock and return the number removed,
+// eviction callbacks run in one batch after the lock is released
+func (mc *mcache) recycle() int {
+	if mc.expireHandler != nil {
+		return mc.handleExpired()
+	}
+
+	mc.Lock()
+	defer mc.unlock()
+
+	return mc.removeExpired()
+}
+
+// removeExpired remove expired cache entries and return the number removed, caller must hold the lock
+func (mc *mcache) removeExpired() int {
+	xs := mc.sweeper.expired(mc, mc.now())
+	for _, x := range xs {
+		mc.remove(x.Key, x, EvictReasonExpired)
+	}
+
+	mc.countEvictions(len(xs))
+	return len(xs)
+}
+
+// handleExpired pass expired cache entries to the expire handler outside the lock, then remove
+// those it doesn't keep and return the number removed. Kept entries are checked again by the next sweep
+func (mc *mcache) handleExpired() int {
+	mc.Lock()
+	xs := mc.sweeper.expired(mc, mc.now())
+	mc.unlock()
+
+	keep := make([]bool, len(xs))
+	for i, x := range xs {
+		keep[i] = mc.expireHandler(x.Key, x.Value)
+	}
+
+	mc.Lock()
+	defer mc.unlock()
+
+	n, now := 0, mc.now()
+	for i, x := range xs {
+		if mc.items[x.Key] != x {
+			continue
+		}
+
+		if keep[i] || !x.expired(now) {
+			mc.sweeper.schedule(x)
+		} else {
+			mc.remove(x.Key, x, EvictReasonExpired)
+			n++
+		}
+	}
+
+	mc.countEvictions(n)
+	return n
 }
 
-// stopTick can stop goroutine of expire
+// Close stop the goroutine of expire, it is safe to call Close more than once. A closed cache is
+// no longer swept, so putting a new entry into it panics, or return ErrClosed for the methods
+// returning an error like PutE, AddE and LoadJSON. Reads, updates and deletes keep working on the
+// entries left, computed and loaded values are returned but not cached
+func (c *MCache) Close() error {
+	runtime.SetFinalizer(c, nil)
+	c.close()
+	return nil
+}
+
+// stopTick can stop goroutine of expire, unlike Close it doesn't close the cache: the finalizer
+// calls it once the MCache is unreachable while the cache may still be used through a method value
+// or a view
 func stopTick(self *MCache) {
-	self.stop <- true
+	self.halt()
+}
+
+// stopped mark the goroutine of expire as returned
+func (mc *mcache) stopped() {
+	mc.Lock()
+	defer mc.unlock()
+
+	mc.running = false
+}
+
+// IsExpiring return whether the goroutine of expire is running, it is false for caches created
+// without it and as soon as Close return, even if the goroutine hasn't returned yet
+func (mc *mcache) IsExpiring() bool {
+	mc.RLock()
+	defer mc.RUnlock()
+
+	return mc.running && !mc.halted
+}
+
+// mustOpen panic if the cache is closed, caller must hold the lock
+func (mc *mcache) mustOpen() {
+	if mc.closed {
+		panic(ErrClosed)
+	}
+}
+
+// close mark the cache closed and signal the goroutine of expire to return
+func (mc *mcache) close() {
+	mc.Lock()
+	defer mc.unlock()
+
+	mc.closed = true
+	mc.haltLocked()
+}
+
+// halt signal the goroutine of expire to return without closing the cache
+func (mc *mcache) halt() {
+	mc.Lock()
+	defer mc.unlock()
+
+	mc.haltLocked()
+}
+
+// haltLocked close stop once, closing stop never blocks even if no goroutine was started
+// or it has already returned, caller must hold the lock
+func (mc *mcache) haltLocked() {
+	if mc.halted {
+		return
+	}
+	mc.halted = true
+	close(mc.stop)
 }
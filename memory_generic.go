@@ -0,0 +1,174 @@
+// Copyright 2013 by sdm. All rights reserved.
+
+package mcache
+
+import (
+	"runtime"
+	"time"
+)
+
+// Cache is a type-safe cache in memory, it shares the implementation of MCache
+type Cache[V any] struct {
+	mc *mcache
+}
+
+// NewG return a new Cache for values of type V configured by opts
+func NewG[V any](opts ...Option) *Cache[V] {
+	cache := newMCache(opts...)
+	c := &Cache[V]{cache}
+
+	if cache.expire {
+		cache.start()
+		runtime.SetFinalizer(c, (*Cache[V]).stopTick)
+	}
+
+	return c
+}
+
+// NewMemoryCacheG return a new Cache for values of type V
+func NewMemoryCacheG[V any](expire bool) *Cache[V] {
+	return NewG[V](withExpiration(expire))
+}
+
+// PutP set a cache entry that never expires
+func (c *Cache[V]) PutP(key string, value V) {
+	c.mc.PutP(key, value)
+}
+
+// PutAbs set a cache entry with AbsoluteExpiration
+func (c *Cache[V]) PutAbs(key string, value V, expire time.Duration) {
+	c.mc.PutAbs(key, value, expire)
+}
+
+// PutSlid set a cache entry with SlidingExpiration
+func (c *Cache[V]) PutSlid(key string, value V, expire time.Duration) {
+	c.mc.PutSlid(key, value, expire)
+}
+
+// Put set a cache entry with expire time span and kind
+func (c *Cache[V]) Put(key string, value V, expire time.Duration, kind ExpirationKind) {
+	c.mc.Put(key, value, expire, kind)
+}
+
+// Set set a cache entry with the default expiration set by WithDefaultExpiration
+func (c *Cache[V]) Set(key string, value V) {
+	c.mc.Set(key, value)
+}
+
+// Get return a cached value, it return false if key doesn't exist, a miss is loaded with WithLoader
+func (c *Cache[V]) Get(key string) (V, bool) {
+	v, ok := c.mc.get(key, true)
+	if !ok {
+		if c.mc.loader != nil {
+			v, ok := c.mc.loadKey(key)
+			return value[V](v), ok
+		}
+		var zero V
+		return zero, false
+	}
+
+	return value[V](v.value), true
+}
+
+// GetOrDefault return a cached value, or def if key doesn't exist or is expired
+func (c *Cache[V]) GetOrDefault(key string, def V) V {
+	if v, ok := c.Get(key); ok {
+		return v
+	}
+
+	return def
+}
+
+// GetV return cached value and it's version
+func (c *Cache[V]) GetV(key string) (V, int, bool) {
+	v, ok := c.mc.get(key, true)
+	if !ok {
+		var zero V
+		return zero, 0, false
+	}
+
+	return value[V](v.value), int(v.version), true
+}
+
+// Add insert a cache entry, it return false if key exist
+func (c *Cache[V]) Add(key string, value V, expire time.Duration, kind ExpirationKind) bool {
+	return c.mc.Add(key, value, expire, kind)
+}
+
+// Update update cache entry, it return false if key doesn't exist
+func (c *Cache[V]) Update(key string, value V) bool {
+	return c.mc.Update(key, value)
+}
+
+// UpdateV update cache entry when version match
+func (c *Cache[V]) UpdateV(key string, version int, value V) bool {
+	return c.mc.UpdateV(key, version, value)
+}
+
+// Delete delete cache entry from the cache
+func (c *Cache[V]) Delete(key string) {
+	c.mc.Delete(key)
+}
+
+// DeleteMulti delete some keys from cache
+func (c *Cache[V]) DeleteMulti(keys []string) {
+	c.mc.DeleteMulti(keys)
+}
+
+// Clear deletes everything from the cache
+func (c *Cache[V]) Clear() {
+	c.mc.Clear()
+}
+
+// Count return number of cache entry, maybe include expired
+func (c *Cache[V]) Count() int {
+	return c.mc.Count()
+}
+
+// Exists return whether the key exist
+func (c *Cache[V]) Exists(key string) bool {
+	return c.mc.Exists(key)
+}
+
+// Keys return all cache keys
+func (c *Cache[V]) Keys() []string {
+	return c.mc.Keys()
+}
+
+// Stat return Cache stat information
+func (c *Cache[V]) Stat() string {
+	return c.mc.Stat()
+}
+
+// Stats return hit/miss statistics since the cache was created or ResetStats was called
+func (c *Cache[V]) Stats() CacheStats {
+	return c.mc.Stats()
+}
+
+// ResetStats reset hit/miss statistics to zero
+func (c *Cache[V]) ResetStats() {
+	c.mc.ResetStats()
+}
+
+// IsExpiring return whether the goroutine of expire is running
+func (c *Cache[V]) IsExpiring() bool {
+	return c.mc.IsExpiring()
+}
+
+// Close stop the goroutine of expire, it is safe to call Close more than once, see MCache.Close
+func (c *Cache[V]) Close() error {
+	runtime.SetFinalizer(c, nil)
+	c.mc.close()
+	return nil
+}
+
+// stopTick can stop goroutine of expire
+func (c *Cache[V]) stopTick() {
+	c.mc.halt()
+}
+
+// value return the typed value of cache entry, a nil interface value yields the zero V
+func value[V any](v interface{}) V {
+	t, _ := v.(V)
+	return t
+}
@@ -0,0 +1,31 @@
+package mcache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGeneric(t *testing.T) {
+	cache := NewMemoryCacheG[int](true)
+
+	if n, ok := cache.Get("x"); ok || n != 0 {
+		t.Error("Get Error, Key shouldn't exist:", "x")
+	}
+
+	cache.PutP("x", 5)
+	n, ok := cache.Get("x")
+	assetEqual(t, "Get Error: x", true, ok)
+	assetEqual(t, "Get Error: x", 5, n)
+
+	assetEqual(t, "Add Error: x", false, cache.Add("x", 6, time.Minute, AbsoluteExpiration))
+	assetEqual(t, "Update Error: x", true, cache.Update("x", 7))
+
+	n, v, _ := cache.GetV("x")
+	assetEqual(t, "GetV Error: x", 7, n)
+	assetEqual(t, "GetV Error: x", 1, v)
+	assetEqual(t, "UpdateV Error: x", false, cache.UpdateV("x", 0, 8))
+	assetEqual(t, "UpdateV Error: x", true, cache.UpdateV("x", 1, 8))
+
+	cache.Delete("x")
+	assetEqual(t, "Exists Error: x", false, cache.Exists("x"))
+}
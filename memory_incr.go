@@ -0,0 +1,66 @@
+// Copyright 2013 by sdm. All rights reserved.
+
+package mcache
+
+// Increment add delta to an integer cache entry and return the new value, the stored integer type is kept.
+// It return ErrKeyNotFound if key doesn't exist (the entry isn't created) and ErrNotInteger if the value isn't an integer
+func (mc *mcache) Increment(key string, delta int64) (int64, error) {
+	mc.Lock()
+	defer mc.unlock()
+
+	x, ok := mc.lookup(key)
+	if !ok {
+		return 0, ErrKeyNotFound
+	}
+
+	v, n, err := increment(x.Value, delta)
+	if err != nil {
+		return 0, err
+	}
+
+	mc.setValue(x, v)
+	return n, nil
+}
+
+// Decrement subtract delta from an integer cache entry and return the new value, see Increment
+func (mc *mcache) Decrement(key string, delta int64) (int64, error) {
+	return mc.Increment(key, -delta)
+}
+
+// increment add delta to an integer value, it return the new value in the same type and as int64
+func increment(value interface{}, delta int64) (interface{}, int64, error) {
+	switch v := value.(type) {
+	case int:
+		v += int(delta)
+		return v, int64(v), nil
+	case int8:
+		v += int8(delta)
+		return v, int64(v), nil
+	case int16:
+		v += int16(delta)
+		return v, int64(v), nil
+	case int32:
+		v += int32(delta)
+		return v, int64(v), nil
+	case int64:
+		v += delta
+		return v, v, nil
+	case uint:
+		v += uint(delta)
+		return v, int64(v), nil
+	case uint8:
+		v += uint8(delta)
+		return v, int64(v), nil
+	case uint16:
+		v += uint16(delta)
+		return v, int64(v), nil
+	case uint32:
+		v += uint32(delta)
+		return v, int64(v), nil
+	case uint64:
+		v += uint64(delta)
+		return v, int64(v), nil
+	}
+
+	return nil, 0, ErrNotInteger
+}
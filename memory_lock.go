@@ -0,0 +1,77 @@
+// Copyright 2013 by sdm. All rights reserved.
+
+package mcache
+
+import "sync"
+
+// keyLock is the lock of a key held by WithLock, it is dropped when no caller holds or waits for it
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+// WithLock run fn with the value of key under a lock of the key and store the value it return if
+// store is true. An existing entry keeps its expiration, a new one gets the default expiration set
+// by WithDefaultExpiration. Calls for the same key run one at a time, calls for different keys and
+// other cache operations are not blocked, so fn may use the cache. The value is only stored if the
+// entry was not written, deleted or created by another operation meanwhile, fn is called again
+// with the current value otherwise. A value larger than the max value size is not stored
+func (mc *mcache) WithLock(key string, fn func(value interface{}, ok bool) (newValue interface{}, store bool)) {
+	l := mc.lockKey(key)
+	defer mc.unlockKey(key, l)
+
+	for {
+		v, ok := mc.get(key, true)
+		value, store := fn(v.value, ok)
+		if !store || mc.store(key, v, ok, value) {
+			return
+		}
+	}
+}
+
+// store set the value of key read as v by WithLock, it return false if the entry changed since
+func (mc *mcache) store(key string, v view, ok bool, value interface{}) bool {
+	mc.Lock()
+	defer mc.unlock()
+
+	x, found := mc.lookup(key)
+	switch {
+	case mc.tooLarge(value):
+	case found != ok || (ok && (x != v.item || x.Version != v.version)):
+		return false
+	case ok:
+		mc.setValue(x, value)
+	default:
+		mc.mustOpen()
+		mc.put(key, value, mc.defaultExpire, mc.defaultKind)
+	}
+
+	return true
+}
+
+// lockKey acquire the lock of key
+func (mc *mcache) lockKey(key string) *keyLock {
+	mc.Lock()
+	l, ok := mc.locks[key]
+	if !ok {
+		l = &keyLock{}
+		mc.locks[key] = l
+	}
+	l.refs++
+	mc.unlock()
+
+	l.Lock()
+	return l
+}
+
+// unlockKey release the lock of key
+func (mc *mcache) unlockKey(key string, l *keyLock) {
+	l.Unlock()
+
+	mc.Lock()
+	l.refs--
+	if l.refs == 0 {
+		delete(mc.locks, key)
+	}
+	mc.unlock()
+}
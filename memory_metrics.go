@@ -0,0 +1,44 @@
+// Copyright 2013 by sdm. All rights reserved.
+
+package mcache
+
+// MetricsSink receive cache metrics as they change, it lets an exporter like Prometheus
+// be wired without polling Stat. Counts of one operation are reported in one call, methods
+// are called outside the cache lock and must be safe for concurrent use
+type MetricsSink interface {
+	AddHits(n int)
+	AddMisses(n int)
+	AddEvictions(n int)
+	SetSize(n int)
+}
+
+// nopMetrics is the MetricsSink used when none is set
+type nopMetrics struct{}
+
+func (nopMetrics) AddHits(n int)      {}
+func (nopMetrics) AddMisses(n int)    {}
+func (nopMetrics) AddEvictions(n int) {}
+func (nopMetrics) SetSize(n int)      {}
+
+// countHits record n cache hits
+func (mc *mcache) countHits(n int) {
+	mc.hits.Add(uint64(n))
+	if n > 0 {
+		mc.metrics.AddHits(n)
+	}
+}
+
+// countMisses record n cache misses
+func (mc *mcache) countMisses(n int) {
+	mc.misses.Add(uint64(n))
+	if n > 0 {
+		mc.metrics.AddMisses(n)
+	}
+}
+
+// countEvictions record n cache entries removed by expiration or capacity, they are reported to
+// the MetricsSink by unlock, caller must hold the lock
+func (mc *mcache) countEvictions(n int) {
+	mc.evictions.Add(uint64(n))
+	mc.unreported += n
+}
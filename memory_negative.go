@@ -0,0 +1,27 @@
+// Copyright 2013 by sdm. All rights reserved.
+
+package mcache
+
+import "time"
+
+// negative is the type of Negative, it has a single value so comparison with == always works
+type negative struct{}
+
+// Negative is the value Get return for a key stored by PutNil, it means the absence of the key
+// was cached. Storing nil with Put can't be told apart from a miss by the value alone:
+//
+//	v, ok := cache.Get(key)
+//	switch {
+//	case !ok:
+//		// never looked up or expired, ask the backend
+//	case v == mcache.Negative:
+//		// the backend is known not to have key
+//	default:
+//		// v is the cached value
+//	}
+var Negative interface{} = negative{}
+
+// PutNil cache the absence of key with AbsoluteExpiration, Get return Negative for it until it expires
+func (mc *mcache) PutNil(key string, expire time.Duration) {
+	mc.Put(key, Negative, expire, AbsoluteExpiration)
+}
@@ -0,0 +1,315 @@
+// Copyright 2013 by sdm. All rights reserved.
+
+package mcache
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Option configure a cache created by New
+type Option func(*mcache)
+
+// WithExpiration start a goroutine purging expired cache entries every tick interval
+func WithExpiration() Option {
+	return withExpiration(true)
+}
+
+// WithTickInterval set the interval of expiration check instead of TickInterval, a check runs
+// sooner when an entry is due before it, it can't be less than one second
+func WithTickInterval(d time.Duration) Option {
+	return func(mc *mcache) {
+		mc.tickInterval = d
+	}
+}
+
+// WithTickJitter add a random duration in [0, d) to every wait for the expiration check, so caches
+// created together don't sweep at the same time
+func WithTickJitter(d time.Duration) Option {
+	return func(mc *mcache) {
+		if d > 0 {
+			mc.tickJitter = d
+		}
+	}
+}
+
+// WithMaxEntries limit the cache to n entries, the least recently used entry is evicted
+// when the cache is full, n <= 0 means unlimited
+func WithMaxEntries(n int) Option {
+	return func(mc *mcache) {
+		if n > 0 {
+			mc.maxEntries = n
+			mc.trackRecency()
+		}
+	}
+}
+
+// WithMaxEntriesFIFO limit the cache to n entries like WithMaxEntries, but the oldest inserted
+// entry is evicted when the cache is full. Reads and updates don't change the order, so reads
+// never take the write lock, expired entries are still evicted first. A policy set by
+// WithEvictionPolicy is kept whatever the order of the options
+func WithMaxEntriesFIFO(n int) Option {
+	return func(mc *mcache) {
+		if n > 0 {
+			mc.maxEntries = n
+			if !mc.customPolicy {
+				mc.policy, mc.trackAccess = NewFIFOPolicy(), false
+			}
+		}
+	}
+}
+
+// WithMaxBytes limit the estimated size of all cache entries to n bytes, the least recently
+// used entries are evicted when a put or update exceeds it. Sizes come from the Sizer set by
+// WithSizer, the limit is only as accurate as the Sizer, n <= 0 means unlimited
+func WithMaxBytes(n int64) Option {
+	return func(mc *mcache) {
+		if n > 0 {
+			mc.maxBytes = n
+			mc.trackRecency()
+		}
+	}
+}
+
+// WithMemoryPressureEviction evict a tenth of cache entries, the least recently used by default, at every
+// expiration check while the heap in use, as runtime.ReadMemStats report it, exceeds target bytes.
+// It is approximate, the heap only shrinks once evicted values are garbage collected. It starts
+// the goroutine of expire which runs the checks
+func WithMemoryPressureEviction(target uint64) Option {
+	return func(mc *mcache) {
+		if target > 0 {
+			mc.memoryTarget = target
+			mc.expire = true
+			mc.trackRecency()
+		}
+	}
+}
+
+// WithMaxValueSize reject values larger than n bytes as the Sizer set by WithSizer estimate them.
+// Put and the rest of its family, Swap and WithLock don't store them and keep an existing entry as
+// is, PutE, UpdateE and UpdateVE return ErrValueTooLarge and Update, Replace and UpdateExp return
+// false, n <= 0 means unlimited
+func WithMaxValueSize(n int64) Option {
+	return func(mc *mcache) {
+		if n > 0 {
+			mc.maxValueSize = n
+		}
+	}
+}
+
+// WithLastAccess record when each cache entry is read for IdleTime, reads then always take the
+// write lock to record it
+func WithLastAccess() Option {
+	return func(mc *mcache) {
+		mc.lastAccess = true
+	}
+}
+
+// WithCodec set the functions PutEncoded and GetDecoded use to turn values into bytes and back,
+// either nil keeps encoding/json
+func WithCodec(encode func(interface{}) ([]byte, error), decode func([]byte) (interface{}, error)) Option {
+	return func(mc *mcache) {
+		mc.encode = encode
+		mc.decode = decode
+	}
+}
+
+// WithContentionTracking record how long taking the cache lock waits for LockStats, it is off by
+// default since it reads the clock whenever the lock is contended
+func WithContentionTracking() Option {
+	return func(mc *mcache) {
+		mc.contention = true
+	}
+}
+
+// WithSizer set the function estimating the size of cache values, without it a []byte value has
+// its length as size and every other value has size 0
+func WithSizer(fn Sizer) Option {
+	return func(mc *mcache) {
+		mc.sizer = fn
+	}
+}
+
+// WithCopyOnGet make Get and the like, Items, Range and the compute and loader functions return
+// copier(value) instead of the stored value, so callers may modify what they get. Values leaving
+// the cache, returned by Swap or GetAndDelete or passed to callbacks, are not copied. By default
+// values are not copied: a slice, map or pointer stored in the cache is shared by every reader and
+// modifying it changes the cached value under them
+func WithCopyOnGet(copier func(interface{}) interface{}) Option {
+	return func(mc *mcache) {
+		mc.copier = copier
+	}
+}
+
+// WithSeed seed the random source of the cache, like PutMultiJittered use, mostly for tests
+func WithSeed(seed int64) Option {
+	return func(mc *mcache) {
+		mc.rand = rand.New(rand.NewSource(seed))
+	}
+}
+
+// WithStatRedactor set the function formatting cache values for Stat and StatN, like masking
+// secrets, so the output is safe to expose on an admin endpoint
+func WithStatRedactor(fn func(key string, value interface{}) string) Option {
+	return func(mc *mcache) {
+		mc.statRedactor = fn
+	}
+}
+
+// WithClock set the source of current time, mostly for tests
+func WithClock(c Clock) Option {
+	return func(mc *mcache) {
+		mc.clock = c
+	}
+}
+
+// WithOnEvicted set a callback called when cache entry leaves the cache, see OnEvicted
+func WithOnEvicted(fn func(key string, value interface{}, reason EvictReason)) Option {
+	return func(mc *mcache) {
+		mc.onEvicted = fn
+	}
+}
+
+// WithMetrics set the sink receiving hit, miss, eviction and size metrics, nil keeps the default no-op sink
+func WithMetrics(sink MetricsSink) Option {
+	return func(mc *mcache) {
+		if sink != nil {
+			mc.metrics = sink
+		}
+	}
+}
+
+// WithDefaultExpiration set the expire time span and kind Set use for cache entries,
+// Put and the like still take their own
+func WithDefaultExpiration(expire time.Duration, kind ExpirationKind) Option {
+	return func(mc *mcache) {
+		mc.defaultExpire = expire
+		mc.defaultKind = kind
+	}
+}
+
+// WithMaxTTL clamp the expiration of cache entries put or touched afterwards to d, including those
+// put by PutP which would never expire. Sliding entries expire d after their last access at most
+func WithMaxTTL(d time.Duration) Option {
+	return func(mc *mcache) {
+		if d >= _minExpiration {
+			mc.maxTTL = d
+		}
+	}
+}
+
+// WithSlidingTouchThrottle make Get and the like refresh a sliding or idle cache entry only when it
+// was last refreshed at least d ago, so most reads stay on the read lock instead of taking the write
+// lock to touch it. An entry may then expire up to d before its sliding window would otherwise end.
+// It has no effect while recency or last access is tracked, which take the write lock on every read
+func WithSlidingTouchThrottle(d time.Duration) Option {
+	return func(mc *mcache) {
+		if d > 0 {
+			mc.touchThrottle = d
+		}
+	}
+}
+
+// WithMinExpiration raise the expire time span of cache entries put or touched afterwards to d
+// when it is shorter, so tiny TTLs don't churn the cache. Entries that never expire are left as is
+func WithMinExpiration(d time.Duration) Option {
+	return func(mc *mcache) {
+		if d >= _minExpiration {
+			mc.minExpire = d
+		}
+	}
+}
+
+// WithStrictExpiration make an expire time span of 0 or less than a microsecond expire the entry as
+// soon as possible, instead of never like by default, only NoExpiration and other negative spans
+// mean never expire. It applies everywhere an expire is taken, like PutIdle
+func WithStrictExpiration() Option {
+	return func(mc *mcache) {
+		mc.strictExpire = true
+	}
+}
+
+// WithRefreshAhead make GetOrCompute and GetOrComputeCtx recompute an entry in the background
+// when a hit finds less than fraction of its expiration left, readers keep getting the current
+// value meanwhile. Expired entries are still computed synchronously, fraction must be in (0, 1)
+func WithRefreshAhead(fraction float64) Option {
+	return func(mc *mcache) {
+		if fraction > 0 && fraction < 1 {
+			mc.refreshAhead = fraction
+		}
+	}
+}
+
+// WithExpireHandler set a function called for each expired cache entry at every expiration check,
+// before it is removed, like flushing it to a backing store. Returning true keeps the entry for the
+// next check. The function is called outside the lock in a batch per check, Get doesn't remove
+// expired entries itself with it, entries evicted for capacity are not passed to it
+func WithExpireHandler(fn func(key string, value interface{}) (keep bool)) Option {
+	return func(mc *mcache) {
+		mc.expireHandler = fn
+	}
+}
+
+// WithLoader set a function Get call on a miss to load the value of key along with its expire time
+// span and kind, the result is cached and concurrent misses of the same key share one call. Errors
+// are not cached, Get then return false. Peek only return what is in the cache
+func WithLoader(fn func(key string) (interface{}, time.Duration, ExpirationKind, error)) Option {
+	return func(mc *mcache) {
+		mc.loader = fn
+	}
+}
+
+// WithWriteThrough set a function called with every value stored in the cache, by the Put, Add,
+// Update, Swap and Increment families, WithLock, Rename under the new key, the compute and loader
+// functions and the like, after it is stored and outside the lock, like persisting it to a backing
+// store. Entries copied from another cache by Clone, Merge and MergeLatest or restored by LoadJSON
+// and RestoreGob are not written, the values returned by onConflict of Merge are. PutE, UpdateE
+// and UpdateVE return its error, mode choose whether the entry is kept or removed then. A removed
+// entry is not restored to its previous value, the next read misses instead
+func WithWriteThrough(fn func(key string, value interface{}) error, mode WriteThroughMode) Option {
+	return func(mc *mcache) {
+		mc.writeThrough = fn
+		mc.writeThroughMode = mode
+	}
+}
+
+// WithLinearSweep make expiration checks scan all cache entries at every tick interval, instead of
+// only visiting the entries that are due and checking again when the next one is
+func WithLinearSweep() Option {
+	return func(mc *mcache) {
+		mc.sweeper = linearSweep{}
+	}
+}
+
+// WithTimingWheel make expiration checks visit cache entries bucketed by the second they expire in,
+// only the buckets whose second has passed are examined. Touched entries move between buckets, the
+// check removes an expired entry up to one second late, Get still never return it
+func WithTimingWheel() Option {
+	return func(mc *mcache) {
+		mc.sweeper = newWheelSweep()
+	}
+}
+
+// WithEvictionPolicy set the policy choosing which cache entry to evict when the cache exceeds the
+// limit set by WithMaxEntries or WithMaxBytes, instead of evicting the least recently used one.
+// It takes precedence over WithMaxEntriesFIFO whatever the order of the options
+func WithEvictionPolicy(p EvictionPolicy) Option {
+	return func(mc *mcache) {
+		if p != nil {
+			mc.policy, mc.trackAccess, mc.customPolicy = p, true, true
+		}
+	}
+}
+
+// trackRecency evict the least recently used cache entry unless a policy is set
+func (mc *mcache) trackRecency() {
+	if mc.policy == nil {
+		mc.policy, mc.trackAccess = NewLRUPolicy(), true
+	}
+}
+
+func withExpiration(expire bool) Option {
+	return func(mc *mcache) {
+		mc.expire = expire
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2013 by sdm. All rights reserved.
+
+package mcache
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// entry is the persisted form of a cache entry, its deadline is saved as the duration
+// remaining at dump time so it can be restored relative to load time
+type entry struct {
+	Key        string            `json:"key"`
+	Value      interface{}       `json:"value"`
+	Version    int64             `json:"version"`
+	Kind       ExpirationKind    `json:"kind"`
+	Expiration time.Duration     `json:"expiration"`
+	Remaining  time.Duration     `json:"remaining"`
+	MaxIdle    time.Duration     `json:"max_idle,omitempty"`
+	Meta       map[string]string `json:"meta,omitempty"`
+}
+
+// DumpJSON write all not expired cache entries to w as JSON.
+// Values are encoded by encoding/json, so they must be JSON-marshalable
+func (mc *mcache) DumpJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(mc.entries())
+}
+
+// LoadJSON read cache entries written by DumpJSON from r and put them into the cache, replacing
+// entries with the same keys. Deadlines are restored relative to load time and idle time restarts.
+// Concrete value types are lost: numbers become float64, objects map[string]interface{} and
+// arrays []interface{}, use SaveGob to keep them
+func (mc *mcache) LoadJSON(r io.Reader) error {
+	var entries []entry
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return err
+	}
+
+	mc.Lock()
+	defer mc.unlock()
+
+	if mc.closed {
+		return ErrClosed
+	}
+	mc.load(entries)
+	return nil
+}
+
+// SaveGob write all not expired cache entries to w with encoding/gob, which keeps concrete
+// value types. Types stored behind interface{} must be registered with gob.Register
+func (mc *mcache) SaveGob(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(mc.entries())
+}
+
+// RestoreGob replace the cache content with cache entries written by SaveGob from r,
+// deadlines are restored relative to restore time and idle time restarts
+func (mc *mcache) RestoreGob(r io.Reader) error {
+	var entries []entry
+	if err := gob.NewDecoder(r).Decode(&entries); err != nil {
+		return err
+	}
+
+	mc.Lock()
+	defer mc.unlock()
+
+	if mc.closed {
+		return ErrClosed
+	}
+	mc.clear()
+	mc.load(entries)
+	return nil
+}
+
+// entries return the persisted form of all not expired cache entries
+func (mc *mcache) entries() []entry {
+	mc.RLock()
+	defer mc.RUnlock()
+
+	now := mc.now()
+	entries := make([]entry, 0, len(mc.items))
+	for k, x := range mc.items {
+		if x.expired(now) {
+			continue
+		}
+
+		e := entry{
+			Key:        k,
+			Value:      x.Value,
+			Version:    x.Version,
+			Kind:       x.Kind,
+			Expiration: x.Expiration,
+			MaxIdle:    x.MaxIdle,
+			Meta:       x.Meta,
+		}
+		if !x.NoExpire {
+			e.Remaining = x.ExpAt.Sub(now)
+		}
+		entries = append(entries, e)
+	}
+
+	return entries
+}
+
+// load put persisted cache entries into the cache, caller must hold the lock
+func (mc *mcache) load(entries []entry) {
+	now := mc.now()
+	for _, e := range entries {
+		if e.Expiration >= _minExpiration && e.Remaining <= 0 {
+			continue
+		}
+
+		expire := e.Expiration
+		if expire < _minExpiration {
+			expire = NoExpiration
+		}
+
+		x := mc.put(e.Key, e.Value, expire, e.Kind)
+		if x == nil {
+			continue
+		}
+		x.Version = e.Version
+		x.Meta = e.Meta
+		if !x.NoExpire && e.Remaining > 0 && e.Remaining < x.Expiration {
+			x.ExpAt = now.Add(e.Remaining)
+		}
+		x.setMaxIdle(now, e.MaxIdle)
+		mc.sweeper.schedule(x)
+	}
+
+	// restored entries come from the backing store or a copy of it, they aren't written back
+	mc.unwritten = nil
+}
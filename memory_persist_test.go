@@ -0,0 +1,77 @@
+package mcache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+	"time"
+)
+
+func TestJSON(t *testing.T) {
+	clock := NewFakeClock()
+	cache := NewMemoryCacheWithClock(clock, false)
+
+	cache.PutAbs("a", "a", 2*time.Minute)
+	cache.PutSlid("b", 1, time.Hour)
+	cache.Update("b", 2)
+	cache.PutP("c", []int{1, 2})
+	cache.PutAbs("d", "d", time.Second)
+	clock.Advance(time.Minute)
+
+	var buf bytes.Buffer
+	if err := cache.DumpJSON(&buf); err != nil {
+		t.Fatal("DumpJSON Error:", err)
+	}
+
+	restored := NewMemoryCacheWithClock(clock, false)
+	if err := restored.LoadJSON(&buf); err != nil {
+		t.Fatal("LoadJSON Error:", err)
+	}
+
+	assetEqual(t, "Count Error", 3, restored.Count())
+	assetGet(t, restored, "a", "a")
+
+	_, at, _ := restored.GetWithExpiry("a")
+	assetEqual(t, "LoadJSON Error: a", clock.Now().Add(time.Minute), at)
+
+	v, version, at, _ := restored.GetFull("b")
+	assetEqual(t, "LoadJSON Error: b", float64(2), v)
+	assetEqual(t, "LoadJSON Error: b", 1, version)
+	assetEqual(t, "LoadJSON Error: b", clock.Now().Add(time.Hour), at)
+
+	_, at, _ = restored.GetWithExpiry("c")
+	assetEqual(t, "LoadJSON Error: c", true, at.IsZero())
+}
+
+type gobValue struct {
+	Name string
+}
+
+func TestGob(t *testing.T) {
+	gob.Register(gobValue{})
+
+	clock := NewFakeClock()
+	cache := NewMemoryCacheWithClock(clock, false)
+
+	cache.PutAbs("a", gobValue{"a"}, 2*time.Minute)
+	cache.PutP("b", 2)
+	clock.Advance(time.Minute)
+
+	var buf bytes.Buffer
+	if err := cache.SaveGob(&buf); err != nil {
+		t.Fatal("SaveGob Error:", err)
+	}
+
+	restored := NewMemoryCacheWithClock(clock, false)
+	restored.PutP("c", 3)
+	if err := restored.RestoreGob(&buf); err != nil {
+		t.Fatal("RestoreGob Error:", err)
+	}
+
+	assetEqual(t, "Count Error", 2, restored.Count())
+	assetGet(t, restored, "a", gobValue{"a"})
+	assetGet(t, restored, "b", 2)
+
+	_, at, _ := restored.GetWithExpiry("a")
+	assetEqual(t, "RestoreGob Error: a", clock.Now().Add(time.Minute), at)
+}
@@ -0,0 +1,79 @@
+// Copyright 2013 by sdm. All rights reserved.
+
+package mcache
+
+import "container/list"
+
+// EvictionPolicy choose which cache entry to evict when the cache exceeds its max entries or
+// max bytes. The cache calls it under its lock, so an implementation used by a single cache
+// doesn't need to be safe for concurrent use
+type EvictionPolicy interface {
+	// OnInsert is called when key is put into the cache
+	OnInsert(key string)
+	// OnAccess is called when key is read or updated
+	OnAccess(key string)
+	// OnRemove is called when key leaves the cache for any reason
+	OnRemove(key string)
+	// Victim return the key to evict next, false if there is none
+	Victim() (key string, ok bool)
+}
+
+// lruPolicy evict the least recently used key
+type lruPolicy struct {
+	ll    *list.List
+	elems map[string]*list.Element
+}
+
+// NewLRUPolicy return an EvictionPolicy evicting the least recently used key, it is the policy
+// of WithMaxEntries and WithMaxBytes
+func NewLRUPolicy() EvictionPolicy {
+	return &lruPolicy{list.New(), map[string]*list.Element{}}
+}
+
+func (p *lruPolicy) OnInsert(key string) {
+	p.elems[key] = p.ll.PushFront(key)
+}
+
+func (p *lruPolicy) OnAccess(key string) {
+	if e, ok := p.elems[key]; ok {
+		p.ll.MoveToFront(e)
+	}
+}
+
+func (p *lruPolicy) OnRemove(key string) {
+	if e, ok := p.elems[key]; ok {
+		p.ll.Remove(e)
+		delete(p.elems, key)
+	}
+}
+
+func (p *lruPolicy) Victim() (string, bool) {
+	if e := p.ll.Back(); e != nil {
+		return e.Value.(string), true
+	}
+
+	return "", false
+}
+
+// fifoPolicy evict the oldest inserted key, it is an lruPolicy ignoring access
+type fifoPolicy struct {
+	lruPolicy
+}
+
+// NewFIFOPolicy return an EvictionPolicy evicting the oldest inserted key, it is the policy
+// of WithMaxEntriesFIFO
+func NewFIFOPolicy() EvictionPolicy {
+	return &fifoPolicy{lruPolicy{list.New(), map[string]*list.Element{}}}
+}
+
+func (p *fifoPolicy) OnAccess(key string) {}
+
+// keys return the keys of the policy from the next victim to the last one
+func (p *lruPolicy) keys() []string {
+	keys := make([]string, 0, len(p.elems))
+	for e := p.ll.Back(); e != nil; e = e.Prev() {
+		keys = append(keys, e.Value.(string))
+	}
+
+	return keys
+}
@@ -0,0 +1,35 @@
+// Copyright 2013 by sdm. All rights reserved.
+
+package mcache
+
+import "runtime"
+
+// _pressureEvictDivisor make each memory pressure check evict 1/_pressureEvictDivisor of cache entries
+const _pressureEvictDivisor = 10
+
+// relievePressure evict a tenth of cache entries chosen by the eviction policy if the heap exceeds the
+// memory target set by WithMemoryPressureEviction and return the number evicted, it is called
+// at every expiration check so memory is released gradually
+func (mc *mcache) relievePressure() int {
+	if mc.memoryTarget == 0 {
+		return 0
+	}
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	if ms.HeapAlloc <= mc.memoryTarget {
+		return 0
+	}
+
+	mc.Lock()
+	defer mc.unlock()
+
+	n := (len(mc.items) + _pressureEvictDivisor - 1) / _pressureEvictDivisor
+	for i := 0; i < n; i++ {
+		if !mc.evictVictim() {
+			return i
+		}
+	}
+
+	return n
+}
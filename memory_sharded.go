@@ -0,0 +1,391 @@
+// Copyright 2013 by sdm. All rights reserved.
+
+package mcache
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	_fnvOffset32 uint32 = 2166136261
+	_fnvPrime32  uint32 = 16777619
+)
+
+// ShardedCache is cache in memory split into shards by key hash, every shard has its own lock
+// and expiration goroutine, it has the same API as MCache
+type ShardedCache struct {
+	shards []*MCache
+}
+
+// NewShardedCache return a new ShardedCache with n shards
+func NewShardedCache(n int, expire bool) *ShardedCache {
+	if n < 1 {
+		n = 1
+	}
+
+	sc := &ShardedCache{shards: make([]*MCache, n)}
+	for i := range sc.shards {
+		sc.shards[i] = NewMemoryCache(expire)
+	}
+
+	return sc
+}
+
+// PutP set a cache entry that never expires
+func (sc *ShardedCache) PutP(key string, value interface{}) {
+	sc.shard(key).PutP(key, value)
+}
+
+// PutAbs set a cache entry with AbsoluteExpiration
+func (sc *ShardedCache) PutAbs(key string, value interface{}, expire time.Duration) {
+	sc.shard(key).PutAbs(key, value, expire)
+}
+
+// PutSlid set a cache entry with SlidingExpiration
+func (sc *ShardedCache) PutSlid(key string, value interface{}, expire time.Duration) {
+	sc.shard(key).PutSlid(key, value, expire)
+}
+
+// Put set a cache entry with expire time span and kind
+func (sc *ShardedCache) Put(key string, value interface{}, expire time.Duration, kind ExpirationKind) {
+	sc.shard(key).Put(key, value, expire, kind)
+}
+
+// PutMulti set some cache entries with the same expire time span and kind, one lock per shard
+func (sc *ShardedCache) PutMulti(entries map[string]interface{}, expire time.Duration, kind ExpirationKind) {
+	groups := make(map[*MCache]map[string]interface{}, len(sc.shards))
+	for k, v := range entries {
+		s := sc.shard(k)
+		if groups[s] == nil {
+			groups[s] = map[string]interface{}{}
+		}
+		groups[s][k] = v
+	}
+
+	for s, g := range groups {
+		s.PutMulti(g, expire, kind)
+	}
+}
+
+// Get return a cached value, it return false if key doesn't exist or is expired
+func (sc *ShardedCache) Get(key string) (interface{}, bool) {
+	return sc.shard(key).Get(key)
+}
+
+// TryGet return a cached value without waiting for the lock of its shard, see MCache.TryGet
+func (sc *ShardedCache) TryGet(key string) (interface{}, bool, bool) {
+	return sc.shard(key).TryGet(key)
+}
+
+// GetOrDefault return a cached value, or def if key doesn't exist or is expired
+func (sc *ShardedCache) GetOrDefault(key string, def interface{}) interface{} {
+	return sc.shard(key).GetOrDefault(key, def)
+}
+
+// GetV return cached value and it's version
+func (sc *ShardedCache) GetV(key string) (interface{}, int, bool) {
+	return sc.shard(key).GetV(key)
+}
+
+// GetV64 return cached value and it's version
+func (sc *ShardedCache) GetV64(key string) (interface{}, int64, bool) {
+	return sc.shard(key).GetV64(key)
+}
+
+// GetWithExpiry return a cached value and the time it expires at,
+// a zero expiresAt means the entry never expires
+func (sc *ShardedCache) GetWithExpiry(key string) (interface{}, time.Time, bool) {
+	return sc.shard(key).GetWithExpiry(key)
+}
+
+// GetMulti return cached values of keys, missing or expired keys are absent from the result
+func (sc *ShardedCache) GetMulti(keys []string) map[string]interface{} {
+	groups := make(map[*MCache][]string, len(sc.shards))
+	for _, k := range keys {
+		s := sc.shard(k)
+		groups[s] = append(groups[s], k)
+	}
+
+	values := make(map[string]interface{}, len(keys))
+	for s, g := range groups {
+		for k, v := range s.GetMulti(g) {
+			values[k] = v
+		}
+	}
+
+	return values
+}
+
+// GetOrCompute return a cached value, on a miss fn is called once for all concurrent callers
+// of the same key and its result is cached, nothing is cached if fn returns an error
+func (sc *ShardedCache) GetOrCompute(key string, expire time.Duration, kind ExpirationKind, fn func() (interface{}, error)) (interface{}, error) {
+	return sc.shard(key).GetOrCompute(key, expire, kind, fn)
+}
+
+// GetOrComputeCtx is GetOrCompute with a context, see MCache.GetOrComputeCtx
+func (sc *ShardedCache) GetOrComputeCtx(ctx context.Context, key string, expire time.Duration, kind ExpirationKind, fn func(context.Context) (interface{}, error)) (interface{}, error) {
+	return sc.shard(key).GetOrComputeCtx(ctx, key, expire, kind, fn)
+}
+
+// Add insert a cache entry, it return false if key exist
+func (sc *ShardedCache) Add(key string, value interface{}, expire time.Duration, kind ExpirationKind) bool {
+	return sc.shard(key).Add(key, value, expire, kind)
+}
+
+// LoadOrStore return the existing value of key or store value, see MCache.LoadOrStore
+func (sc *ShardedCache) LoadOrStore(key string, value interface{}, expire time.Duration, kind ExpirationKind) (interface{}, bool) {
+	return sc.shard(key).LoadOrStore(key, value, expire, kind)
+}
+
+// Swap set the value of key and return the previous one, see MCache.Swap
+func (sc *ShardedCache) Swap(key string, value interface{}) (interface{}, bool) {
+	return sc.shard(key).Swap(key, value)
+}
+
+// PutIf put value only if key doesn't exist or less(old, value) is true, see MCache.PutIf
+func (sc *ShardedCache) PutIf(key string, value interface{}, less func(old, new interface{}) bool, expire time.Duration, kind ExpirationKind) bool {
+	return sc.shard(key).PutIf(key, value, less, expire, kind)
+}
+
+// GetAndSet put value with a fresh expiration and return the value it replaced, see MCache.GetAndSet
+func (sc *ShardedCache) GetAndSet(key string, value interface{}, expire time.Duration, kind ExpirationKind) (interface{}, bool) {
+	return sc.shard(key).GetAndSet(key, value, expire, kind)
+}
+
+// Update update cache entry, it return false if key doesn't exist
+func (sc *ShardedCache) Update(key string, value interface{}) bool {
+	return sc.shard(key).Update(key, value)
+}
+
+// UpdateV update cache entry when version match
+func (sc *ShardedCache) UpdateV(key string, version int, value interface{}) bool {
+	return sc.shard(key).UpdateV(key, version, value)
+}
+
+// UpdateV64 update cache entry when version match
+func (sc *ShardedCache) UpdateV64(key string, version int64, value interface{}) bool {
+	return sc.shard(key).UpdateV64(key, version, value)
+}
+
+// Replace update cache entry value and reset its expiration, it return false if key doesn't exist
+func (sc *ShardedCache) Replace(key string, value interface{}, expire time.Duration, kind ExpirationKind) bool {
+	return sc.shard(key).Replace(key, value, expire, kind)
+}
+
+// SetKind change the expiration kind of cache entry and reset its expiration, see MCache.SetKind
+func (sc *ShardedCache) SetKind(key string, kind ExpirationKind, expire time.Duration) bool {
+	return sc.shard(key).SetKind(key, kind, expire)
+}
+
+// UpdateExp update cache entry value and reset its expiration keeping its kind, it return false if key doesn't exist
+func (sc *ShardedCache) UpdateExp(key string, value interface{}, expire time.Duration) bool {
+	return sc.shard(key).UpdateExp(key, value, expire)
+}
+
+// Increment add delta to an integer cache entry and return the new value, see MCache.Increment
+func (sc *ShardedCache) Increment(key string, delta int64) (int64, error) {
+	return sc.shard(key).Increment(key, delta)
+}
+
+// Decrement subtract delta from an integer cache entry and return the new value, see MCache.Increment
+func (sc *ShardedCache) Decrement(key string, delta int64) (int64, error) {
+	return sc.shard(key).Decrement(key, delta)
+}
+
+// Delete delete cache entry from the cache
+func (sc *ShardedCache) Delete(key string) {
+	sc.shard(key).Delete(key)
+}
+
+// GetAndDelete return a cached value and delete it atomically, it return false if key doesn't exist
+func (sc *ShardedCache) GetAndDelete(key string) (interface{}, bool) {
+	return sc.shard(key).GetAndDelete(key)
+}
+
+// DeleteMulti delete some keys from cache
+func (sc *ShardedCache) DeleteMulti(keys []string) {
+	for _, k := range keys {
+		sc.shard(k).Delete(k)
+	}
+}
+
+// DeleteMultiR delete some keys from cache and return the removed values, see MCache.DeleteMultiR.
+// It is atomic per shard only, one lock per shard
+func (sc *ShardedCache) DeleteMultiR(keys []string) map[string]interface{} {
+	groups := make(map[*MCache][]string, len(sc.shards))
+	for _, k := range keys {
+		s := sc.shard(k)
+		groups[s] = append(groups[s], k)
+	}
+
+	values := make(map[string]interface{}, len(keys))
+	for s, g := range groups {
+		for k, v := range s.DeleteMultiR(g) {
+			values[k] = v
+		}
+	}
+
+	return values
+}
+
+// Clear deletes everything from the cache
+func (sc *ShardedCache) Clear() {
+	for _, s := range sc.shards {
+		s.Clear()
+	}
+}
+
+// Count return number of cache entry of all shards, maybe include expired. Shards are counted one
+// after another, the sum is not a consistent snapshot across shards
+func (sc *ShardedCache) Count() int {
+	n := 0
+	for _, s := range sc.shards {
+		n += s.Count()
+	}
+
+	return n
+}
+
+// CountValid return number of not expired cache entry of all shards
+func (sc *ShardedCache) CountValid() int {
+	n := 0
+	for _, s := range sc.shards {
+		n += s.CountValid()
+	}
+
+	return n
+}
+
+// Exists return whether the key exist
+func (sc *ShardedCache) Exists(key string) bool {
+	return sc.shard(key).Exists(key)
+}
+
+// Keys return all cache keys of all shards, every shard is read under its own lock, keys put or
+// deleted in other shards meanwhile may or may not be included
+func (sc *ShardedCache) Keys() []string {
+	keys := make([]string, 0, 255)
+	for _, s := range sc.shards {
+		keys = append(keys, s.Keys()...)
+	}
+
+	return keys
+}
+
+// Range call fn for each not expired cache entry of all shards until fn return false, see
+// MCache.Range. Shards are visited one after another, each is consistent on its own but there is
+// no snapshot across shards
+func (sc *ShardedCache) Range(fn func(key string, value interface{}) bool) {
+	more := true
+	for _, s := range sc.shards {
+		s.Range(func(key string, value interface{}) bool {
+			more = fn(key, value)
+			return more
+		})
+		if !more {
+			return
+		}
+	}
+}
+
+// Shards return the number of shards
+func (sc *ShardedCache) Shards() int {
+	return len(sc.shards)
+}
+
+// RangeShard call fn for each not expired cache entry of the shard numbered shard in [0, Shards())
+// until fn return false, like Range for one shard, so shards can be processed in parallel.
+// It does nothing if shard is out of range
+func (sc *ShardedCache) RangeShard(shard int, fn func(key string, value interface{}) bool) {
+	if shard < 0 || shard >= len(sc.shards) {
+		return
+	}
+
+	sc.shards[shard].Range(fn)
+}
+
+// OnEvicted set a callback called when cache entry leaves any shard
+func (sc *ShardedCache) OnEvicted(fn func(key string, value interface{}, reason EvictReason)) {
+	for _, s := range sc.shards {
+		s.OnEvicted(fn)
+	}
+}
+
+// Snapshot return information of all cache entries of all shards
+func (sc *ShardedCache) Snapshot() []EntryInfo {
+	var infos []EntryInfo
+	for _, s := range sc.shards {
+		infos = append(infos, s.Snapshot()...)
+	}
+
+	return infos
+}
+
+// Stat return stat information of all shards
+func (sc *ShardedCache) Stat() string {
+	var stat string
+	for _, s := range sc.shards {
+		stat += s.Stat()
+	}
+
+	return stat
+}
+
+// Stats return hit/miss statistics summed over all shards
+func (sc *ShardedCache) Stats() CacheStats {
+	var stats CacheStats
+	for _, s := range sc.shards {
+		st := s.Stats()
+		stats.Hits += st.Hits
+		stats.Misses += st.Misses
+		stats.Evictions += st.Evictions
+	}
+
+	return stats
+}
+
+// ResetStats reset hit/miss statistics of all shards to zero
+func (sc *ShardedCache) ResetStats() {
+	for _, s := range sc.shards {
+		s.ResetStats()
+	}
+}
+
+// Recycle remove expired cache entries of all shards now
+func (sc *ShardedCache) Recycle() {
+	for _, s := range sc.shards {
+		s.Recycle()
+	}
+}
+
+// DeleteExpired remove expired cache entries of all shards now and return the number removed
+func (sc *ShardedCache) DeleteExpired() int {
+	n := 0
+	for _, s := range sc.shards {
+		n += s.DeleteExpired()
+	}
+
+	return n
+}
+
+// Close stop the goroutines of expire of all shards, it is safe to call Close more than once,
+// see MCache.Close
+func (sc *ShardedCache) Close() error {
+	for _, s := range sc.shards {
+		s.Close()
+	}
+
+	return nil
+}
+
+// shard return the shard of key by its FNV-1a hash
+func (sc *ShardedCache) shard(key string) *MCache {
+	h := _fnvOffset32
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= _fnvPrime32
+	}
+
+	return sc.shards[h%uint32(len(sc.shards))]
+}
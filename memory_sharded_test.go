@@ -0,0 +1,101 @@
+package mcache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSharded(t *testing.T) {
+	cache := NewShardedCache(8, true)
+	defer cache.Close()
+
+	for i := 0; i < 100; i++ {
+		cache.PutP(strconv.Itoa(i), i)
+	}
+	cache.PutMulti(map[string]interface{}{"a": "a", "b": "b"}, time.Minute, AbsoluteExpiration)
+
+	assetEqual(t, "Count Error", 102, cache.Count())
+	assetEqual(t, "Keys Error", 102, len(cache.Keys()))
+	assetEqual(t, "GetMulti Error", 3, len(cache.GetMulti([]string{"1", "a", "b", "c"})))
+
+	if v, ok := cache.Get("42"); !ok || v != 42 {
+		t.Error("Get Error, cache value is incorrect:", "42", v)
+	}
+
+	n := 0
+	cache.Range(func(key string, value interface{}) bool {
+		n++
+		return n < 10
+	})
+	assetEqual(t, "Range Error", 10, n)
+
+	cache.DeleteMulti([]string{"a", "b"})
+	assetEqual(t, "Count Error", 100, cache.Count())
+
+	cache.Clear()
+	assetEqual(t, "Count Error", 0, cache.Count())
+}
+
+func TestRangeShard(t *testing.T) {
+	cache := NewShardedCache(4, false)
+
+	for i := 0; i < 100; i++ {
+		cache.PutP(strconv.Itoa(i), i)
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < cache.Shards(); i++ {
+		cache.RangeShard(i, func(key string, value interface{}) bool {
+			if cache.shard(key) != cache.shards[i] {
+				t.Error("RangeShard Error, key from another shard:", key)
+			}
+			seen[key] = true
+			return true
+		})
+	}
+	assetEqual(t, "RangeShard Error", 100, len(seen))
+
+	n := 0
+	cache.Range(func(key string, value interface{}) bool {
+		n++
+		return true
+	})
+	assetEqual(t, "Range Error", 100, n)
+
+	cache.RangeShard(cache.Shards(), func(key string, value interface{}) bool {
+		t.Error("RangeShard Error, out of range shard visited:", key)
+		return true
+	})
+}
+
+func benchmarkGetParallel(b *testing.B, get func(key string) (interface{}, bool), put func(key string, value interface{})) {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i) + "key"
+		put(keys[i], i)
+	}
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			if i%10 == 0 {
+				put(keys[i%len(keys)], i)
+			} else {
+				get(keys[i%len(keys)])
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkGetParallel(b *testing.B) {
+	cache := NewMemoryCache(true)
+	benchmarkGetParallel(b, cache.Get, cache.PutP)
+}
+
+func BenchmarkShardedGetParallel(b *testing.B) {
+	cache := NewShardedCache(32, true)
+	benchmarkGetParallel(b, cache.Get, cache.PutP)
+}
@@ -0,0 +1,135 @@
+// Copyright 2013 by sdm. All rights reserved.
+
+package mcache
+
+import (
+	"container/heap"
+	"time"
+)
+
+// sweeper find and remove expired cache entries, all methods are called with the lock held
+type sweeper interface {
+	// schedule track cache entry after it is put or its expiration is changed
+	schedule(x *item)
+	// touched is called after cache entry deadline moved later by an access
+	touched(x *item)
+	// unschedule stop tracking cache entry removed from the cache
+	unschedule(x *item)
+	// expired return expired cache entries and stop tracking them, they are still in the cache
+	expired(mc *mcache, now time.Time) []*item
+	// next return the soonest time an entry may expire, false if unknown or none
+	next() (time.Time, bool)
+	// reset stop tracking all cache entries
+	reset()
+}
+
+// linearSweep scan all cache entries on every sweep, it is selected by WithLinearSweep
+type linearSweep struct{}
+
+func (linearSweep) schedule(x *item)   {}
+func (linearSweep) touched(x *item)    {}
+func (linearSweep) unschedule(x *item) {}
+func (linearSweep) reset()             {}
+
+func (linearSweep) next() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (linearSweep) expired(mc *mcache, now time.Time) []*item {
+	var xs []*item
+	for _, x := range mc.items {
+		if x.expirable() && x.expired(now) {
+			xs = append(xs, x)
+		}
+	}
+
+	return xs
+}
+
+// heapSweep keep expirable cache entries in a min-heap by deadline so a sweep only visits the
+// entries that are due. Sliding and idle entries move their deadline later when accessed without
+// the heap knowing, they are pushed back with the new deadline when they come up
+type heapSweep struct {
+	h deadlineHeap
+}
+
+func (s *heapSweep) schedule(x *item) {
+	if !x.expirable() {
+		s.unschedule(x)
+		return
+	}
+
+	x.due = x.expiresAt()
+	if x.index >= 0 {
+		heap.Fix(&s.h, x.index)
+	} else {
+		heap.Push(&s.h, x)
+	}
+}
+
+// touched does nothing, the entry is pushed back when it comes up
+func (s *heapSweep) touched(x *item) {}
+
+func (s *heapSweep) unschedule(x *item) {
+	if x.index >= 0 {
+		heap.Remove(&s.h, x.index)
+	}
+}
+
+func (s *heapSweep) reset() {
+	for _, x := range s.h {
+		x.index = -1
+	}
+	s.h = nil
+}
+
+func (s *heapSweep) next() (time.Time, bool) {
+	if len(s.h) == 0 {
+		return time.Time{}, false
+	}
+
+	return s.h[0].due, true
+}
+
+func (s *heapSweep) expired(mc *mcache, now time.Time) []*item {
+	var xs []*item
+	for len(s.h) > 0 && s.h[0].due.Before(now) {
+		x := s.h[0]
+		if x.expired(now) {
+			heap.Pop(&s.h)
+			xs = append(xs, x)
+		} else {
+			s.schedule(x)
+		}
+	}
+
+	return xs
+}
+
+// deadlineHeap is a min-heap of cache entries by due time, it implements heap.Interface
+type deadlineHeap []*item
+
+func (h deadlineHeap) Len() int           { return len(h) }
+func (h deadlineHeap) Less(i, j int) bool { return h[i].due.Before(h[j].due) }
+
+func (h deadlineHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *deadlineHeap) Push(v interface{}) {
+	x := v.(*item)
+	x.index = len(*h)
+	*h = append(*h, x)
+}
+
+func (h *deadlineHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	old[n-1] = nil
+	x.index = -1
+	*h = old[:n-1]
+	return x
+}
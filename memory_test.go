@@ -1,7 +1,14 @@
 package mcache
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"runtime"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -21,6 +28,138 @@ func assetGet(t *testing.T, c *MCache, k string, expect interface{}) {
 	}
 }
 
+// FakeClock is a Clock advanced manually by tests
+type FakeClock struct {
+	sync.Mutex
+	now time.Time
+}
+
+func NewFakeClock() *FakeClock {
+	return &FakeClock{now: time.Now()}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) Advance(d time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestNew(t *testing.T) {
+	clock := NewFakeClock()
+	evicted := 0
+	cache := New(
+		WithExpiration(),
+		WithTickInterval(time.Hour),
+		WithMaxEntries(2),
+		WithClock(clock),
+		WithOnEvicted(func(key string, value interface{}, reason EvictReason) {
+			evicted++
+		}),
+	)
+	defer cache.Close()
+
+	cache.PutAbs("a", 1, time.Minute)
+	cache.PutP("b", 2)
+	cache.PutP("c", 3)
+	assetEqual(t, "Capacity Error", 2, cache.Capacity())
+	assetEqual(t, "Count Error", 2, cache.Count())
+	assetEqual(t, "OnEvicted Error", 1, evicted)
+
+	cache.PutAbs("d", 4, time.Minute)
+	clock.Advance(2 * time.Minute)
+	assetEqual(t, "Exists Error: d", false, cache.Exists("d"))
+}
+
+func TestSet(t *testing.T) {
+	clock := NewFakeClock()
+	cache := New(WithClock(clock), WithDefaultExpiration(time.Minute, SlidingExpiration))
+
+	cache.Set("a", 1)
+	cache.Put("b", 2, 5*time.Minute, AbsoluteExpiration)
+	clock.Advance(50 * time.Second)
+	assetGet(t, cache, "a", 1)
+
+	clock.Advance(2 * time.Minute)
+	assetEqual(t, "Exists Error: a", false, cache.Exists("a"))
+	assetGet(t, cache, "b", 2)
+
+	cache = NewMemoryCacheWithClock(clock, false)
+	cache.Set("a", 1)
+	clock.Advance(time.Hour)
+	assetGet(t, cache, "a", 1)
+}
+
+func TestGetOrDefault(t *testing.T) {
+	clock := NewFakeClock()
+	cache := NewMemoryCacheWithClock(clock, false)
+	cache.PutSlid("a", 1, time.Minute)
+
+	clock.Advance(50 * time.Second)
+	assetEqual(t, "GetOrDefault Error: a", 1, cache.GetOrDefault("a", 0))
+	clock.Advance(50 * time.Second)
+	assetEqual(t, "GetOrDefault Error: a", 1, cache.GetOrDefault("a", 0))
+	assetEqual(t, "GetOrDefault Error: b", 0, cache.GetOrDefault("b", 0))
+}
+
+func TestPutWithMeta(t *testing.T) {
+	cache := NewMemoryCache(false)
+
+	meta := map[string]string{"source": "db"}
+	cache.PutWithMeta("a", 1, meta, time.Minute, AbsoluteExpiration)
+	meta["source"] = "changed"
+	cache.Update("a", 2)
+
+	v, m, ok := cache.GetWithMeta("a")
+	assetEqual(t, "GetWithMeta Error: a", true, ok)
+	assetEqual(t, "GetWithMeta Error: a", 2, v)
+	assetEqual(t, "GetWithMeta Error: a", "db", m["source"])
+
+	cache.PutP("a", 3)
+	_, m, _ = cache.GetWithMeta("a")
+	assetEqual(t, "GetWithMeta Error: a", 0, len(m))
+}
+
+func TestCopyOnGet(t *testing.T) {
+	cache := New(WithCopyOnGet(func(v interface{}) interface{} {
+		return append([]int(nil), v.([]int)...)
+	}))
+
+	cache.PutP("a", []int{1, 2})
+	v, _ := cache.Get("a")
+	v.([]int)[0] = 3
+
+	v, _ = cache.Get("a")
+	assetEqual(t, "CopyOnGet Error: a", 1, v.([]int)[0])
+	assetEqual(t, "CopyOnGet Error: a", 1, cache.GetMulti([]string{"a"})["a"].([]int)[0])
+
+	cache.Items()["a"].([]int)[0] = 3
+	cache.Range(func(key string, value interface{}) bool {
+		value.([]int)[1] = 3
+		return true
+	})
+	v, _ = cache.GetOrCompute("b", NoExpiration, AbsoluteExpiration, func() (interface{}, error) {
+		return []int{1, 2}, nil
+	})
+	v.([]int)[0] = 3
+	assetEqual(t, "CopyOnGet Error: a", "[1 2]", fmt.Sprint(cache.Items()["a"]))
+	assetEqual(t, "CopyOnGet Error: b", "[1 2]", fmt.Sprint(cache.Items()["b"]))
+
+	loaded := New(WithCopyOnGet(func(v interface{}) interface{} {
+		return append([]int(nil), v.([]int)...)
+	}), WithLoader(func(key string) (interface{}, time.Duration, ExpirationKind, error) {
+		return []int{1, 2}, NoExpiration, AbsoluteExpiration, nil
+	}))
+	v, _ = loaded.Get("a")
+	v.([]int)[0] = 3
+	assetEqual(t, "CopyOnGet Error: loaded", "[1 2]", fmt.Sprint(loaded.Items()["a"]))
+}
+
 func TestAdd(t *testing.T) {
 	cache := NewMemoryCache(true)
 	key := "int"
@@ -39,6 +178,95 @@ func TestAdd(t *testing.T) {
 
 }
 
+func TestLoadOrStore(t *testing.T) {
+	cache := NewMemoryCache(false)
+
+	v, loaded := cache.LoadOrStore("a", 1, time.Minute, AbsoluteExpiration)
+	assetEqual(t, "LoadOrStore Error: a", 1, v)
+	assetEqual(t, "LoadOrStore Error: a", false, loaded)
+
+	v, loaded = cache.LoadOrStore("a", 2, time.Minute, AbsoluteExpiration)
+	assetEqual(t, "LoadOrStore Error: a", 1, v)
+	assetEqual(t, "LoadOrStore Error: a", true, loaded)
+
+	cache.PutAbs("b", 1, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	v, loaded = cache.LoadOrStore("b", 2, time.Minute, AbsoluteExpiration)
+	assetEqual(t, "LoadOrStore Error: b", 2, v)
+	assetEqual(t, "LoadOrStore Error: b", false, loaded)
+	assetGet(t, cache, "b", 2)
+}
+
+func TestSwap(t *testing.T) {
+	cache := New(WithDefaultExpiration(time.Minute, AbsoluteExpiration))
+
+	v, loaded := cache.Swap("a", 1)
+	assetEqual(t, "Swap Error: a", nil, v)
+	assetEqual(t, "Swap Error: a", false, loaded)
+
+	v, loaded = cache.Swap("a", 2)
+	assetEqual(t, "Swap Error: a", 1, v)
+	assetEqual(t, "Swap Error: a", true, loaded)
+
+	v, version, _ := cache.GetV("a")
+	assetEqual(t, "Swap Error: a", 2, v)
+	assetEqual(t, "Swap Error: a", 1, version)
+	assetEqual(t, "Swap Error: a", false, cache.Snapshot()[0].ExpiresAt.IsZero())
+}
+
+func TestGetAndSet(t *testing.T) {
+	clock := NewFakeClock()
+	cache := NewMemoryCacheWithClock(clock, false)
+
+	old, existed := cache.GetAndSet("a", 1, time.Minute, AbsoluteExpiration)
+	assetEqual(t, "GetAndSet Error: a", nil, old)
+	assetEqual(t, "GetAndSet Error: a", false, existed)
+
+	clock.Advance(40 * time.Second)
+	old, existed = cache.GetAndSet("a", 2, time.Minute, SlidingExpiration)
+	assetEqual(t, "GetAndSet Error: a", 1, old)
+	assetEqual(t, "GetAndSet Error: a", true, existed)
+
+	e, _ := cache.Describe("a")
+	assetEqual(t, "GetAndSet Error: kind", SlidingExpiration, e.Kind)
+	assetEqual(t, "GetAndSet Error: expires", clock.Now().Add(time.Minute), e.ExpiresAt)
+}
+
+func TestGetAndSetCopy(t *testing.T) {
+	cache := New(WithCopyOnGet(func(v interface{}) interface{} {
+		return append([]int(nil), v.([]int)...)
+	}))
+	stored := []int{1}
+	cache.PutP("a", stored)
+
+	old, _ := cache.GetAndSet("a", []int{2}, time.Minute, AbsoluteExpiration)
+	old.([]int)[0] = 3
+	assetEqual(t, "GetAndSet Error: copy", 1, stored[0])
+}
+
+func TestPutIf(t *testing.T) {
+	cache := NewMemoryCache(false)
+	less := func(old, new interface{}) bool { return old.(int) < new.(int) }
+
+	assetEqual(t, "PutIf Error: absent", true, cache.PutIf("a", 5, less, time.Minute, AbsoluteExpiration))
+	assetEqual(t, "PutIf Error: lower", false, cache.PutIf("a", 3, less, time.Minute, AbsoluteExpiration))
+	assetEqual(t, "PutIf Error: equal", false, cache.PutIf("a", 5, less, time.Minute, AbsoluteExpiration))
+	assetEqual(t, "PutIf Error: higher", true, cache.PutIf("a", 7, less, time.Minute, AbsoluteExpiration))
+	assetGet(t, cache, "a", 7)
+}
+
+func TestGetOrPut(t *testing.T) {
+	cache := NewMemoryCache(false)
+
+	v, loaded := cache.GetOrPut("a", 1, time.Minute, AbsoluteExpiration)
+	assetEqual(t, "GetOrPut Error: a", 1, v)
+	assetEqual(t, "GetOrPut Error: a", false, loaded)
+
+	v, loaded = cache.GetOrPut("a", 2, time.Minute, AbsoluteExpiration)
+	assetEqual(t, "GetOrPut Error: a", 1, v)
+	assetEqual(t, "GetOrPut Error: a", true, loaded)
+}
+
 func TestBasic(t *testing.T) {
 	cache := NewMemoryCache(true)
 
@@ -105,90 +333,1950 @@ func TestCas(t *testing.T) {
 
 	cache.Update("int", i)
 	if ok := cache.UpdateV(key, i, i); ok {
-		t.Errorf("UpdateV Error, expect %d, actual %d", false, ok)
+		t.Errorf("UpdateV Error, expect %t, actual %t", false, ok)
 	}
 
 	i++
 	if ok := cache.UpdateV(key, i, i); !ok {
-		t.Errorf("UpdateV Error, expect %d, actual %d", true, ok)
+		t.Errorf("UpdateV Error, expect %t, actual %t", true, ok)
 	}
 
 }
 
-func TestExpire(t *testing.T) {
+func TestCas64(t *testing.T) {
 	cache := NewMemoryCache(true)
+	cache.PutP("int", 0)
+	cache.Update("int", 1)
 
-	var interval = 10 * time.Millisecond
+	_, v, _ := cache.GetV64("int")
+	assetEqual(t, "GetV64 Error", int64(1), v)
+	assetEqual(t, "UpdateV64 Error", false, cache.UpdateV64("int", 0, 2))
+	assetEqual(t, "UpdateV64 Error", true, cache.UpdateV64("int", 1, 2))
+}
 
-	cache.Put("a", 1, 2*interval, AbsoluteExpiration)
+func TestDeleteV(t *testing.T) {
+	cache := NewMemoryCache(true)
+	cache.PutP("int", 0)
+	cache.Update("int", 1)
 
-	time.Sleep(1 * interval)
-	if _, ok := cache.Get("a"); !ok {
-		t.Error("Expire error, cache a should exists")
+	assetEqual(t, "DeleteV Error", false, cache.DeleteV("int", 0))
+	assetEqual(t, "Exists Error", true, cache.Exists("int"))
+	assetEqual(t, "DeleteV Error", true, cache.DeleteV("int", 1))
+	assetEqual(t, "Exists Error", false, cache.Exists("int"))
+	assetEqual(t, "DeleteV Error", false, cache.DeleteV("int", 1))
+}
+
+func TestErrors(t *testing.T) {
+	cache := NewMemoryCache(false)
+
+	assetEqual(t, "UpdateE Error", ErrKeyNotFound, cache.UpdateE("a", 1))
+	assetEqual(t, "UpdateVE Error", ErrKeyNotFound, cache.UpdateVE("a", 0, 1))
+	assetEqual(t, "AddE Error", nil, cache.AddE("a", 1, time.Minute, AbsoluteExpiration))
+	assetEqual(t, "AddE Error", ErrKeyExists, cache.AddE("a", 2, time.Minute, AbsoluteExpiration))
+	assetEqual(t, "UpdateVE Error", ErrVersionMismatch, cache.UpdateVE("a", 1, 2))
+	assetEqual(t, "UpdateVE Error", nil, cache.UpdateVE("a", 0, 2))
+	assetEqual(t, "UpdateE Error", nil, cache.UpdateE("a", 3))
+	assetGet(t, cache, "a", 3)
+}
+
+func TestCasConcurrent(t *testing.T) {
+	cache := NewMemoryCache(true)
+	cache.PutP("int", 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				x, v, _ := cache.GetV("int")
+				if cache.UpdateV("int", v, x.(int)+1) {
+					return
+				}
+			}
+		}()
 	}
+	wg.Wait()
 
-	//<-time.After(1 * time.Millisecond)
-	time.Sleep(2 * interval)
-	if _, ok := cache.Get("a"); ok {
-		t.Error("Expire error, cache a should be expired")
+	assetGet(t, cache, "int", 20)
+}
+
+func TestGetVUpdateConcurrent(t *testing.T) {
+	cache := NewMemoryCache(false)
+	cache.PutP("a", 0)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= 1000; i++ {
+			cache.Update("a", i)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			v, version, _ := cache.GetV("a")
+			if v != version {
+				t.Error("GetV Error, value and version read apart:", v, version)
+				return
+			}
+			cache.Get("a")
+		}
+	}()
+	wg.Wait()
+}
+
+func TestGetWithExpiry(t *testing.T) {
+	cache := NewMemoryCache(true)
+
+	cache.PutP("a", 1)
+	v, at, ok := cache.GetWithExpiry("a")
+	assetEqual(t, "GetWithExpiry Error: a", 1, v)
+	assetEqual(t, "GetWithExpiry Error: a", true, ok)
+	assetEqual(t, "GetWithExpiry Error: a", true, at.IsZero())
+
+	before := time.Now()
+	cache.PutAbs("b", 2, time.Minute)
+	_, at, _ = cache.GetWithExpiry("b")
+	if at.Before(before.Add(time.Minute)) || at.After(time.Now().Add(time.Minute)) {
+		t.Error("GetWithExpiry Error, unexpected expiration:", at)
 	}
 
-	// test absolute expiration
-	cache.PutAbs("b", 1, 2*interval)
+	if _, _, ok := cache.GetWithExpiry("c"); ok {
+		t.Error("GetWithExpiry Error, Key shouldn't exist:", "c")
+	}
+}
 
-	time.Sleep(1 * interval)
-	if !cache.Exists("b") {
-		t.Error("Expire error, cache b should exists")
+func TestIncrement(t *testing.T) {
+	cache := NewMemoryCache(true)
+
+	cache.PutP("int", 1)
+	n, err := cache.Increment("int", 2)
+	assetEqual(t, "Increment Error", int64(3), n)
+	assetEqual(t, "Increment Error", nil, err)
+
+	n, err = cache.Decrement("int", 5)
+	assetEqual(t, "Decrement Error", int64(-2), n)
+	assetGet(t, cache, "int", -2)
+
+	cache.PutP("uint8", uint8(255))
+	cache.Increment("uint8", 1)
+	assetGet(t, cache, "uint8", uint8(0))
+
+	cache.PutP("string", "string")
+	_, err = cache.Increment("string", 1)
+	assetEqual(t, "Increment Error", ErrNotInteger, err)
+
+	_, err = cache.Increment("none", 1)
+	assetEqual(t, "Increment Error", ErrKeyNotFound, err)
+}
+
+func TestPutMulti(t *testing.T) {
+	cache := NewMemoryCache(true)
+	cache.PutMulti(map[string]interface{}{"a": 1, "b": 2}, time.Minute, AbsoluteExpiration)
+
+	assetEqual(t, "Count Error", 2, cache.Count())
+	assetGet(t, cache, "a", 1)
+	assetGet(t, cache, "b", 2)
+}
+
+func TestGetMulti(t *testing.T) {
+	cache := NewMemoryCache(true)
+	cache.PutP("a", 1)
+	cache.PutP("b", 2)
+	cache.PutAbs("c", 3, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	values := cache.GetMulti([]string{"a", "b", "c", "d"})
+	assetEqual(t, "GetMulti Error", 2, len(values))
+	assetEqual(t, "GetMulti Error: a", 1, values["a"])
+	assetEqual(t, "GetMulti Error: b", 2, values["b"])
+	assetEqual(t, "Stats Error", CacheStats{Hits: 2, Misses: 2}, cache.Stats())
+}
+
+func TestReplace(t *testing.T) {
+	cache := NewMemoryCache(true)
+
+	assetEqual(t, "Replace Error: a", false, cache.Replace("a", 1, time.Minute, AbsoluteExpiration))
+	assetEqual(t, "Exists Error: a", false, cache.Exists("a"))
+
+	cache.PutAbs("a", 1, time.Millisecond)
+	assetEqual(t, "Replace Error: a", true, cache.Replace("a", 2, time.Minute, SlidingExpiration))
+	time.Sleep(5 * time.Millisecond)
+
+	v, version, ok := cache.GetV("a")
+	assetEqual(t, "Replace Error: a", true, ok)
+	assetEqual(t, "Replace Error: a", 2, v)
+	assetEqual(t, "Replace Error: a", 1, version)
+}
+
+func TestUpdateExp(t *testing.T) {
+	clock := NewFakeClock()
+	cache := NewMemoryCacheWithClock(clock, false)
+
+	assetEqual(t, "UpdateExp Error: a", false, cache.UpdateExp("a", 1, time.Minute))
+	assetEqual(t, "Exists Error: a", false, cache.Exists("a"))
+
+	cache.PutSlid("a", 1, time.Minute)
+	clock.Advance(30 * time.Second)
+	assetEqual(t, "UpdateExp Error: a", true, cache.UpdateExp("a", 2, 5*time.Minute))
+
+	v, version, at, _ := cache.GetFull("a")
+	assetEqual(t, "UpdateExp Error: a", 2, v)
+	assetEqual(t, "UpdateExp Error: a", 1, version)
+	assetEqual(t, "UpdateExp Error: a", clock.Now().Add(5*time.Minute), at)
+
+	assetEqual(t, "UpdateExp Error: a", SlidingExpiration, cache.Snapshot()[0].Kind)
+}
+
+func TestRename(t *testing.T) {
+	cache := NewMemoryCacheLRU(2, false)
+
+	evicted := map[string]EvictReason{}
+	cache.OnEvicted(func(key string, value interface{}, reason EvictReason) {
+		evicted[key] = reason
+	})
+
+	assetEqual(t, "Rename Error: a", false, cache.Rename("a", "b"))
+
+	cache.PutAbs("a", 1, time.Minute)
+	cache.Update("a", 2)
+	cache.PutP("b", 3)
+	assetEqual(t, "Rename Error: a", true, cache.Rename("a", "b"))
+	assetEqual(t, "Exists Error: a", false, cache.Exists("a"))
+
+	v, version, ok := cache.GetV("b")
+	assetEqual(t, "Rename Error: b", true, ok)
+	assetEqual(t, "Rename Error: b", 2, v)
+	assetEqual(t, "Rename Error: b", 1, version)
+	assetEqual(t, "Rename Error: b", AbsoluteExpiration, cache.Snapshot()[0].Kind)
+	assetEqual(t, "OnEvicted Error", 1, len(evicted))
+	assetEqual(t, "OnEvicted Error: b", EvictReasonReplaced, evicted["b"])
+
+	cache.PutP("c", 4)
+	cache.PutP("d", 5)
+	assetEqual(t, "Exists Error: b", false, cache.Exists("b"))
+}
+
+func TestDeleteIf(t *testing.T) {
+	cache := NewMemoryCache(false)
+	cache.PutP("a", "running")
+
+	done := func(v interface{}) bool { return v == "done" }
+	assetEqual(t, "DeleteIf Error: a", false, cache.DeleteIf("a", done))
+	assetEqual(t, "DeleteIf Error: b", false, cache.DeleteIf("b", done))
+
+	cache.Update("a", "done")
+	assetEqual(t, "DeleteIf Error: a", true, cache.DeleteIf("a", done))
+	assetEqual(t, "Exists Error: a", false, cache.Exists("a"))
+}
+
+func TestGetAndDelete(t *testing.T) {
+	cache := NewMemoryCache(true)
+	cache.PutP("a", 1)
+
+	v, ok := cache.GetAndDelete("a")
+	assetEqual(t, "GetAndDelete Error", 1, v)
+	assetEqual(t, "GetAndDelete Error", true, ok)
+	assetEqual(t, "Exists Error: a", false, cache.Exists("a"))
+
+	_, ok = cache.GetAndDelete("a")
+	assetEqual(t, "GetAndDelete Error", false, ok)
+}
+
+func TestDeleteMultiR(t *testing.T) {
+	clock := NewFakeClock()
+	cache := NewMemoryCacheWithClock(clock, false)
+	cache.PutP("a", 1)
+	cache.PutP("b", 2)
+	cache.PutAbs("c", 3, time.Second)
+	cache.PutP("d", 4)
+	clock.Advance(time.Minute)
+
+	reasons := map[string]EvictReason{}
+	cache.OnEvicted(func(key string, value interface{}, reason EvictReason) {
+		reasons[key] = reason
+	})
+
+	values := cache.DeleteMultiR([]string{"a", "b", "c", "e"})
+	assetEqual(t, "DeleteMultiR Error", 2, len(values))
+	assetEqual(t, "DeleteMultiR Error: a", 1, values["a"])
+	assetEqual(t, "DeleteMultiR Error: b", 2, values["b"])
+	assetEqual(t, "Count Error", 1, cache.Count())
+	assetEqual(t, "OnEvicted Error: a", EvictReasonDeleted, reasons["a"])
+	assetEqual(t, "OnEvicted Error: c", EvictReasonExpired, reasons["c"])
+	assetEqual(t, "Stats Error: evictions", uint64(1), cache.Stats().Evictions)
+}
+
+func TestSnapshot(t *testing.T) {
+	cache := NewMemoryCache(true)
+	cache.PutSlid("a", 1, time.Minute)
+	cache.Update("a", 2)
+	cache.PutAbs("b", 1, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	infos := map[string]EntryInfo{}
+	for _, info := range cache.Snapshot() {
+		infos[info.Key] = info
 	}
 
-	time.Sleep(2 * interval)
-	if cache.Exists("b") {
-		t.Error("Expire error, cache b should be expired")
+	assetEqual(t, "Snapshot Error", 2, len(infos))
+	assetEqual(t, "Snapshot Error: a", SlidingExpiration, infos["a"].Kind)
+	assetEqual(t, "Snapshot Error: a", int64(1), infos["a"].Version)
+	assetEqual(t, "Snapshot Error: a", false, infos["a"].Expired)
+	assetEqual(t, "Snapshot Error: b", true, infos["b"].Expired)
+}
+
+func TestSortedKeys(t *testing.T) {
+	cache := NewMemoryCache(true)
+	for _, k := range []string{"c", "a", "b"} {
+		cache.PutP(k, k)
 	}
 
-	// test sliding expiration
-	cache.PutSlid("c", 1, 2*interval)
+	keys := cache.SortedKeys()
+	assetEqual(t, "SortedKeys Error", "a,b,c", strings.Join(keys, ","))
+}
 
-	for i := 0; i < 10; i++ {
-		if _, ok := cache.Get("c"); !ok {
-			t.Error("Expire error, cache c should exists", i)
-		}
-		time.Sleep(1 * interval)
+func TestItems(t *testing.T) {
+	cache := NewMemoryCache(false)
+	cache.PutP("a", 1)
+	cache.PutP("b", 2)
+	cache.PutAbs("c", 3, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	items := cache.Items()
+	cache.Delete("a")
+
+	assetEqual(t, "Items Error", 2, len(items))
+	assetEqual(t, "Items Error: a", 1, items["a"])
+	assetEqual(t, "Items Error: b", 2, items["b"])
+}
+
+func TestKeysChan(t *testing.T) {
+	cache := NewMemoryCache(false)
+	for _, k := range []string{"c", "a", "b"} {
+		cache.PutP(k, k)
 	}
 
-	time.Sleep(2 * interval)
-	if cache.Exists("c") {
-		t.Error("Expire error, cache c should be expired")
+	var keys []string
+	for k := range cache.KeysChan(context.Background()) {
+		keys = append(keys, k)
+		cache.Delete(k)
 	}
+	sort.Strings(keys)
+	assetEqual(t, "KeysChan Error", "a,b,c", strings.Join(keys, ","))
 
+	cache.PutP("a", 1)
+	cache.PutP("b", 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := cache.KeysChan(ctx)
+	<-ch
+	cancel()
+	for range ch {
+	}
 }
 
-// time.now() take time
-func BenchmarkGet(b *testing.B) {
-	var key = "a"
-	b.StopTimer()
+func TestExistsMulti(t *testing.T) {
+	cache := NewMemoryCache(false)
+	cache.PutP("a", 1)
+	cache.PutAbs("b", 1, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	exists := cache.ExistsMulti([]string{"a", "b", "c"})
+	assetEqual(t, "ExistsMulti Error", 3, len(exists))
+	assetEqual(t, "ExistsMulti Error: a", true, exists["a"])
+	assetEqual(t, "ExistsMulti Error: b", false, exists["b"])
+	assetEqual(t, "ExistsMulti Error: c", false, exists["c"])
+}
+
+func TestPrefix(t *testing.T) {
 	cache := NewMemoryCache(true)
-	cache.PutP(key, key)
-	b.StartTimer()
+	cache.PutP("user:1:profile", 1)
+	cache.PutP("user:1:settings", 1)
+	cache.PutP("user:2:profile", 2)
 
-	for i := 0; i < b.N; i++ {
-		cache.Get(key)
+	assetEqual(t, "KeysWithPrefix Error", 2, len(cache.KeysWithPrefix("user:1:")))
+	assetEqual(t, "DeletePrefix Error", 2, cache.DeletePrefix("user:1:"))
+	assetEqual(t, "Count Error", 1, cache.Count())
+	assetEqual(t, "Exists Error", true, cache.Exists("user:2:profile"))
+}
+
+func TestDeleteMatch(t *testing.T) {
+	cache := NewMemoryCache(true)
+	cache.PutP("session:1:temp", 1)
+	cache.PutP("session:2:temp", 2)
+	cache.PutP("session:2:user", 2)
+
+	n, err := cache.DeleteMatch("session:*:temp")
+	assetEqual(t, "DeleteMatch Error", nil, err)
+	assetEqual(t, "DeleteMatch Error", 2, n)
+	assetEqual(t, "Exists Error", true, cache.Exists("session:2:user"))
+
+	n, err = cache.DeleteMatch("session:[")
+	assetEqual(t, "DeleteMatch Error", path.ErrBadPattern, err)
+	assetEqual(t, "DeleteMatch Error", 0, n)
+	assetEqual(t, "Count Error", 1, cache.Count())
+}
+
+func TestReadOnly(t *testing.T) {
+	cache := NewMemoryCache(true)
+	view := cache.ReadOnly()
+
+	cache.PutP("a", 1)
+	if v, ok := view.Get("a"); !ok || v != 1 {
+		t.Error("ReadOnly Error, cache value is incorrect:", v)
+	}
+	assetEqual(t, "ReadOnly Error", 1, view.Count())
+
+	if _, ok := view.(*MCache); ok {
+		t.Error("ReadOnly Error, view should not be writable")
 	}
 }
 
-func BenchmarkGetM(b *testing.B) {
-	var key = "key"
-	count := 1000 * 1000
-	b.StopTimer()
+func TestRange(t *testing.T) {
 	cache := NewMemoryCache(true)
-	for i := 0; i < count; i++ {
-		cache.PutP(strconv.Itoa(i)+key, i)
+	cache.PutP("a", 1)
+	cache.PutP("b", 2)
+	cache.PutAbs("c", 3, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	sum := 0
+	cache.Range(func(key string, value interface{}) bool {
+		sum += value.(int)
+		return true
+	})
+	assetEqual(t, "Range Error", 3, sum)
+
+	n := 0
+	cache.Range(func(key string, value interface{}) bool {
+		n++
+		return false
+	})
+	assetEqual(t, "Range Error", 1, n)
+}
+
+func TestGetPurge(t *testing.T) {
+	cache := NewMemoryCache(false)
+
+	cache.PutAbs("a", 1, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	assetEqual(t, "Count Error", 1, cache.Count())
+
+	if _, ok := cache.Get("a"); ok {
+		t.Error("Get Error, cache a should be expired")
 	}
-	key = "1000key"
-	b.StartTimer()
+	assetEqual(t, "Count Error", 0, cache.Count())
+}
 
-	for i := 0; i < b.N; i++ {
-		_, _ = cache.Get(key)
+func TestFIFO(t *testing.T) {
+	cache := New(WithMaxEntriesFIFO(3))
+	assetEqual(t, "Capacity Error", 3, cache.Capacity())
+
+	cache.PutP("a", 1)
+	cache.PutP("b", 2)
+	cache.PutP("c", 3)
+	cache.Get("a")
+	cache.Update("a", 11)
+	cache.PutP("d", 4)
+
+	assetEqual(t, "Count Error", 3, cache.Count())
+	assetEqual(t, "Exists Error: a", false, cache.Exists("a"))
+
+	cache.Delete("d")
+	cache.PutAbs("e", 5, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	cache.PutP("f", 6)
+	assetEqual(t, "Exists Error: b", true, cache.Exists("b"))
+	assetEqual(t, "Count Error", 3, cache.Count())
+}
+
+// smallestPolicy evict the lexically smallest key
+type smallestPolicy map[string]bool
+
+func (p smallestPolicy) OnInsert(key string) { p[key] = true }
+func (p smallestPolicy) OnAccess(key string) {}
+func (p smallestPolicy) OnRemove(key string) { delete(p, key) }
+
+func (p smallestPolicy) Victim() (string, bool) {
+	keys := make([]string, 0, len(p))
+	for k := range p {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if len(keys) == 0 {
+		return "", false
+	}
+	return keys[0], true
+}
+
+func TestTimingWheelReschedule(t *testing.T) {
+	cache := New(WithTimingWheel())
+	for i := 0; i < 1000; i++ {
+		cache.PutAbs("hot", i, time.Hour)
+	}
+
+	s := cache.sweeper.(*wheelSweep)
+	assetEqual(t, "Wheel Error: buckets", 1, len(s.buckets))
+	assetEqual(t, "Wheel Error: seconds", 1, len(s.seconds))
+}
+
+func TestEvictionPolicy(t *testing.T) {
+	cache := New(WithMaxEntries(2), WithEvictionPolicy(smallestPolicy{}))
+
+	cache.PutP("b", 1)
+	cache.PutP("c", 1)
+	cache.PutP("a", 1)
+	assetEqual(t, "Exists Error: a", false, cache.Exists("a"))
+
+	cache.PutP("d", 1)
+	assetEqual(t, "Exists Error: b", false, cache.Exists("b"))
+	assetEqual(t, "Count Error", 2, cache.Count())
+
+	for _, opts := range [][]Option{
+		{WithEvictionPolicy(smallestPolicy{}), WithMaxEntriesFIFO(2)},
+		{WithMaxEntriesFIFO(2), WithEvictionPolicy(smallestPolicy{})},
+	} {
+		cache := New(opts...)
+		cache.PutP("b", 1)
+		cache.PutP("a", 1)
+		cache.PutP("c", 1)
+		assetEqual(t, "Exists Error: a", false, cache.Exists("a"))
+		assetEqual(t, "Exists Error: b", true, cache.Exists("b"))
+	}
+}
+
+func TestOnEvicted(t *testing.T) {
+	cache := NewMemoryCacheLRU(2, true)
+
+	evicted := map[string]EvictReason{}
+	cache.OnEvicted(func(key string, value interface{}, reason EvictReason) {
+		evicted[key] = reason
+		cache.Exists(key)
+	})
+
+	cache.PutP("a", 1)
+	cache.PutP("a", 2)
+	cache.PutP("b", 1)
+	cache.PutP("c", 1)
+	cache.Delete("b")
+	cache.PutAbs("d", 1, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	cache.recycle()
+	cache.PutP("e", 1)
+	cache.Clear()
+
+	assetEqual(t, "OnEvicted Error: a", EvictReasonCapacity, evicted["a"])
+	assetEqual(t, "OnEvicted Error: b", EvictReasonDeleted, evicted["b"])
+	assetEqual(t, "OnEvicted Error: c", EvictReasonCleared, evicted["c"])
+	assetEqual(t, "OnEvicted Error: d", EvictReasonExpired, evicted["d"])
+	assetEqual(t, "OnEvicted Error: e", EvictReasonCleared, evicted["e"])
+}
+
+func TestPutWithCallback(t *testing.T) {
+	clock := NewFakeClock()
+	cache := NewMemoryCacheWithClock(clock, false)
+
+	var global []string
+	cache.OnEvicted(func(key string, value interface{}, reason EvictReason) {
+		global = append(global, key)
+	})
+	own := map[string]interface{}{}
+	onExpire := func(key string, value interface{}) {
+		own[key] = value
+	}
+
+	cache.PutWithCallback("a", 1, time.Minute, AbsoluteExpiration, onExpire)
+	cache.PutWithCallback("b", 2, time.Hour, AbsoluteExpiration, onExpire)
+	cache.PutAbs("c", 3, time.Minute)
+	cache.Update("b", 20)
+
+	clock.Advance(2 * time.Minute)
+	cache.Recycle()
+	cache.Delete("b")
+
+	assetEqual(t, "PutWithCallback Error: count", 2, len(own))
+	assetEqual(t, "PutWithCallback Error: a", 1, own["a"])
+	assetEqual(t, "PutWithCallback Error: b", 20, own["b"])
+	assetEqual(t, "OnEvicted Error: count", 3, len(global))
+}
+
+func TestSubscribe(t *testing.T) {
+	clock := NewFakeClock()
+	cache := NewMemoryCacheWithClock(clock, false)
+	ch := cache.Subscribe()
+
+	cache.PutAbs("a", 1, time.Minute)
+	cache.PutAbs("a", 2, time.Minute)
+	cache.Update("a", 3)
+	cache.PutP("b", 1)
+	cache.Delete("b")
+	clock.Advance(2 * time.Minute)
+	cache.Recycle()
+
+	expect := []Event{
+		{EventPut, "a"}, {EventPut, "a"}, {EventUpdate, "a"},
+		{EventPut, "b"}, {EventDelete, "b"}, {EventExpire, "a"},
+	}
+	for _, e := range expect {
+		assetEqual(t, "Subscribe Error", e, <-ch)
+	}
+
+	for i := 0; i < 2*_eventBuffer; i++ {
+		cache.PutP("c", i)
+	}
+	assetEqual(t, "Subscribe Error", _eventBuffer, len(ch))
+
+	cache.Unsubscribe(ch)
+	for range ch {
+	}
+	cache.PutP("d", 1)
+}
+
+func TestPeek(t *testing.T) {
+	clock := NewFakeClock()
+	cache := NewMemoryCacheWithClock(clock, false)
+	cache.PutSlid("a", 1, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		clock.Advance(40 * time.Second)
+		v, ok := cache.Peek("a")
+		assetEqual(t, "Peek Error: a", i == 0, ok)
+		if ok {
+			assetEqual(t, "Peek Error: a", 1, v)
+		}
+	}
+	assetEqual(t, "Stats Error", CacheStats{}, cache.Stats())
+}
+
+func TestAge(t *testing.T) {
+	clock := NewFakeClock()
+	cache := NewMemoryCacheWithClock(clock, false)
+	cache.PutSlid("a", 1, time.Minute)
+
+	clock.Advance(40 * time.Second)
+	cache.Get("a")
+	cache.Update("a", 2)
+	clock.Advance(40 * time.Second)
+
+	age, ok := cache.Age("a")
+	assetEqual(t, "Age Error: a", true, ok)
+	assetEqual(t, "Age Error: a", 80*time.Second, age)
+
+	_, ok = cache.Age("b")
+	assetEqual(t, "Age Error: b", false, ok)
+}
+
+func TestSetKind(t *testing.T) {
+	clock := NewFakeClock()
+	cache := NewMemoryCacheWithClock(clock, false)
+	cache.PutAbs("a", 1, time.Minute)
+	cache.Update("a", 2)
+
+	clock.Advance(40 * time.Second)
+	assetEqual(t, "SetKind Error: a", true, cache.SetKind("a", SlidingExpiration, time.Minute))
+	assetEqual(t, "SetKind Error: b", false, cache.SetKind("b", SlidingExpiration, time.Minute))
+
+	for i := 0; i < 3; i++ {
+		clock.Advance(40 * time.Second)
+		assetGet(t, cache, "a", 2)
+	}
+
+	e, _ := cache.Describe("a")
+	assetEqual(t, "SetKind Error: kind", SlidingExpiration, e.Kind)
+	assetEqual(t, "SetKind Error: version", int64(1), e.Version)
+}
+
+func TestSlidingTouchThrottle(t *testing.T) {
+	clock := NewFakeClock()
+	cache := New(WithClock(clock), WithSlidingTouchThrottle(10*time.Second))
+	start := clock.Now()
+	cache.PutSlid("a", 1, time.Minute)
+
+	clock.Advance(5 * time.Second)
+	assetGet(t, cache, "a", 1)
+	e, _ := cache.Describe("a")
+	assetEqual(t, "Throttle Error: not touched", start.Add(time.Minute), e.ExpiresAt)
+
+	clock.Advance(10 * time.Second)
+	assetGet(t, cache, "a", 1)
+	e, _ = cache.Describe("a")
+	assetEqual(t, "Throttle Error: touched", clock.Now().Add(time.Minute), e.ExpiresAt)
+}
+
+func TestDescribe(t *testing.T) {
+	clock := NewFakeClock()
+	cache := NewMemoryCacheWithClock(clock, false)
+	created := clock.Now()
+	cache.PutSlid("a", 1, time.Minute)
+	cache.PutP("b", 2)
+
+	clock.Advance(40 * time.Second)
+	e, ok := cache.Describe("a")
+	assetEqual(t, "Describe Error: a", true, ok)
+	assetEqual(t, "Describe Error: a", 1, e.Value)
+	assetEqual(t, "Describe Error: a", SlidingExpiration, e.Kind)
+	assetEqual(t, "Describe Error: a", created, e.CreatedAt)
+	assetEqual(t, "Describe Error: a", created.Add(time.Minute), e.ExpiresAt)
+
+	clock.Advance(40 * time.Second)
+	_, ok = cache.Describe("a")
+	assetEqual(t, "Describe Error: a", false, ok)
+
+	e, _ = cache.Describe("b")
+	assetEqual(t, "Describe Error: b", true, e.ExpiresAt.IsZero())
+}
+
+func TestIdleTime(t *testing.T) {
+	clock := NewFakeClock()
+	cache := New(WithClock(clock), WithLastAccess())
+	cache.PutP("a", 1)
+
+	clock.Advance(time.Minute)
+	idle, _ := cache.IdleTime("a")
+	assetEqual(t, "IdleTime Error: a", time.Minute, idle)
+
+	cache.Get("a")
+	clock.Advance(time.Second)
+	idle, ok := cache.IdleTime("a")
+	assetEqual(t, "IdleTime Error: a", true, ok)
+	assetEqual(t, "IdleTime Error: a", time.Second, idle)
+
+	cache = NewMemoryCacheWithClock(clock, false)
+	cache.PutP("a", 1)
+	_, ok = cache.IdleTime("a")
+	assetEqual(t, "IdleTime Error: a", false, ok)
+}
+
+func TestReplaceAll(t *testing.T) {
+	cache := NewMemoryCache(false)
+	cache.PutP("a", 1)
+	cache.PutP("b", 1)
+
+	cache.ReplaceAll(map[string]interface{}{"b": 2, "c": 3}, time.Minute, AbsoluteExpiration)
+	assetEqual(t, "Count Error", 2, cache.Count())
+	assetEqual(t, "Exists Error: a", false, cache.Exists("a"))
+	assetGet(t, cache, "b", 2)
+	assetGet(t, cache, "c", 3)
+}
+
+func TestGetStale(t *testing.T) {
+	clock := NewFakeClock()
+	cache := NewMemoryCacheWithClock(clock, false)
+	cache.PutAbs("a", 1, time.Minute)
+
+	v, fresh, ok := cache.GetStale("a")
+	assetEqual(t, "GetStale Error: a", 1, v)
+	assetEqual(t, "GetStale Error: a", true, fresh)
+	assetEqual(t, "GetStale Error: a", true, ok)
+
+	clock.Advance(2 * time.Minute)
+	v, fresh, ok = cache.GetStale("a")
+	assetEqual(t, "GetStale Error: a", 1, v)
+	assetEqual(t, "GetStale Error: a", false, fresh)
+	assetEqual(t, "GetStale Error: a", true, ok)
+
+	cache.Recycle()
+	_, _, ok = cache.GetStale("a")
+	assetEqual(t, "GetStale Error: a", false, ok)
+}
+
+func TestSlidingReadersConcurrent(t *testing.T) {
+	cache := NewMemoryCache(false)
+	cache.PutSlid("a", 1, time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				cache.Get("a")
+				cache.GetWithExpiry("a")
+				cache.GetFull("a")
+				cache.GetStale("a")
+				cache.TryGet("a")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestWithLock(t *testing.T) {
+	cache := NewMemoryCache(false)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cache.WithLock("a", func(v interface{}, ok bool) (interface{}, bool) {
+				if !ok {
+					return 1, true
+				}
+				time.Sleep(time.Millisecond)
+				return v.(int) + 1, true
+			})
+		}()
+	}
+	wg.Wait()
+
+	assetGet(t, cache, "a", 10)
+	assetEqual(t, "WithLock Error", 0, len(cache.locks))
+
+	cache.WithLock("b", func(v interface{}, ok bool) (interface{}, bool) {
+		assetEqual(t, "WithLock Error: b", false, ok)
+		return nil, false
+	})
+	assetEqual(t, "Exists Error: b", false, cache.Exists("b"))
+}
+
+func TestWithLockRetry(t *testing.T) {
+	cache := NewMemoryCache(false)
+	cache.PutP("a", 1)
+
+	calls := 0
+	cache.WithLock("a", func(v interface{}, ok bool) (interface{}, bool) {
+		calls++
+		if calls == 1 {
+			cache.Update("a", 10)
+		}
+		return v.(int) + 1, true
+	})
+	assetEqual(t, "WithLock Error: calls", 2, calls)
+	assetGet(t, cache, "a", 11)
+
+	calls = 0
+	cache.WithLock("a", func(v interface{}, ok bool) (interface{}, bool) {
+		calls++
+		if calls == 1 {
+			cache.Delete("a")
+			assetEqual(t, "WithLock Error: ok", true, ok)
+		} else {
+			assetEqual(t, "WithLock Error: ok", false, ok)
+		}
+		return 1, true
+	})
+	assetEqual(t, "WithLock Error: calls", 2, calls)
+	assetGet(t, cache, "a", 1)
+}
+
+func TestSlidingConcurrent(t *testing.T) {
+	cache := NewMemoryCache(false)
+	cache.PutSlid("a", 1, time.Minute)
+	cache.PutIdle("b", 1, 0, time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				cache.Get("a")
+				cache.GetMulti([]string{"a", "b"})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				cache.Recycle()
+				cache.CountValid()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assetEqual(t, "Count Error", 2, cache.CountValid())
+}
+
+func TestGetFull(t *testing.T) {
+	clock := NewFakeClock()
+	cache := NewMemoryCacheWithClock(clock, false)
+
+	cache.PutSlid("a", 1, time.Minute)
+	cache.Update("a", 2)
+	clock.Advance(time.Second)
+
+	v, version, at, ok := cache.GetFull("a")
+	assetEqual(t, "GetFull Error: a", true, ok)
+	assetEqual(t, "GetFull Error: a", 2, v)
+	assetEqual(t, "GetFull Error: a", 1, version)
+	assetEqual(t, "GetFull Error: a", clock.Now().Add(time.Minute), at)
+
+	cache.PutP("b", 1)
+	_, _, at, _ = cache.GetFull("b")
+	assetEqual(t, "GetFull Error: b", true, at.IsZero())
+}
+
+func TestGetAndTouch(t *testing.T) {
+	clock := NewFakeClock()
+	cache := NewMemoryCacheWithClock(clock, false)
+
+	cache.PutAbs("a", 1, time.Minute)
+	clock.Advance(30 * time.Second)
+
+	v, ok := cache.GetAndTouch("a", 2*time.Minute)
+	assetEqual(t, "GetAndTouch Error: a", 1, v)
+	assetEqual(t, "GetAndTouch Error: a", true, ok)
+
+	clock.Advance(time.Minute)
+	assetEqual(t, "Exists Error: a", true, cache.Exists("a"))
+
+	clock.Advance(time.Minute + time.Second)
+	assetEqual(t, "Exists Error: a", false, cache.Exists("a"))
+
+	_, ok = cache.GetAndTouch("a", time.Minute)
+	assetEqual(t, "GetAndTouch Error: a", false, ok)
+}
+
+func TestTouch(t *testing.T) {
+	clock := NewFakeClock()
+	cache := NewMemoryCacheWithClock(clock, false)
+
+	cache.PutSlid("a", 1, time.Minute)
+	assetEqual(t, "Touch Error: a", true, cache.Touch("a", time.Hour))
+
+	clock.Advance(30 * time.Minute)
+	_, at, _ := cache.GetWithExpiry("a")
+	assetEqual(t, "Touch Error: a", clock.Now().Add(time.Hour), at)
+	assetEqual(t, "Touch Error: b", false, cache.Touch("b", time.Hour))
+}
+
+func TestExpire(t *testing.T) {
+	cache := NewMemoryCache(true)
+
+	var interval = 10 * time.Millisecond
+
+	cache.Put("a", 1, 2*interval, AbsoluteExpiration)
+
+	time.Sleep(1 * interval)
+	if _, ok := cache.Get("a"); !ok {
+		t.Error("Expire error, cache a should exists")
+	}
+
+	//<-time.After(1 * time.Millisecond)
+	time.Sleep(2 * interval)
+	if _, ok := cache.Get("a"); ok {
+		t.Error("Expire error, cache a should be expired")
+	}
+
+	// test absolute expiration
+	cache.PutAbs("b", 1, 2*interval)
+
+	time.Sleep(1 * interval)
+	if !cache.Exists("b") {
+		t.Error("Expire error, cache b should exists")
+	}
+
+	time.Sleep(2 * interval)
+	if cache.Exists("b") {
+		t.Error("Expire error, cache b should be expired")
+	}
+
+	// test sliding expiration
+	cache.PutSlid("c", 1, 2*interval)
+
+	for i := 0; i < 10; i++ {
+		if _, ok := cache.Get("c"); !ok {
+			t.Error("Expire error, cache c should exists", i)
+		}
+		time.Sleep(1 * interval)
+	}
+
+	time.Sleep(2 * interval)
+	if cache.Exists("c") {
+		t.Error("Expire error, cache c should be expired")
+	}
+
+}
+
+func TestLRU(t *testing.T) {
+	cache := NewMemoryCacheLRU(3, true)
+	assetEqual(t, "Capacity Error", 3, cache.Capacity())
+
+	cache.PutP("a", 1)
+	cache.PutP("b", 2)
+	cache.PutP("c", 3)
+	cache.Get("a")
+	cache.PutP("d", 4)
+
+	assetEqual(t, "Count Error", 3, cache.Count())
+	assetEqual(t, "Exists Error: a", true, cache.Exists("a"))
+	assetEqual(t, "Exists Error: b", false, cache.Exists("b"))
+
+	cache.Update("c", 33)
+	cache.PutP("e", 5)
+	assetEqual(t, "Exists Error: c", true, cache.Exists("c"))
+	assetEqual(t, "Exists Error: a", false, cache.Exists("a"))
+
+	// expired entries are evicted before the least recently used one
+	cache.PutAbs("f", 6, time.Millisecond)
+	cache.Get("c")
+	time.Sleep(5 * time.Millisecond)
+	cache.PutP("g", 7)
+
+	assetEqual(t, "Count Error", 3, cache.Count())
+	assetEqual(t, "Exists Error: e", true, cache.Exists("e"))
+	assetEqual(t, "Exists Error: g", true, cache.Exists("g"))
+}
+
+func TestTickInterval(t *testing.T) {
+	cache := NewMemoryCacheWithTick(true, time.Millisecond)
+	defer cache.Close()
+
+	cache.PutAbs("a", 1, time.Millisecond)
+	cache.PutP("b", 2)
+	time.Sleep(1500 * time.Millisecond)
+
+	assetEqual(t, "Count Error", 1, cache.Count())
+}
+
+func TestCountValid(t *testing.T) {
+	cache := NewMemoryCache(false)
+	cache.PutAbs("a", 1, time.Millisecond)
+	cache.PutP("b", 2)
+	time.Sleep(5 * time.Millisecond)
+
+	assetEqual(t, "Count Error", 2, cache.Count())
+	assetEqual(t, "CountValid Error", 1, cache.CountValid())
+	assetEqual(t, "Keys Error", 1, len(cache.Keys()))
+}
+
+func TestRecycle(t *testing.T) {
+	cache := NewMemoryCache(false)
+	cache.PutAbs("a", 1, time.Millisecond)
+	cache.PutP("b", 2)
+	time.Sleep(5 * time.Millisecond)
+
+	cache.Recycle()
+	assetEqual(t, "Count Error", 1, cache.Count())
+}
+
+func TestClose(t *testing.T) {
+	cache := NewMemoryCache(true)
+	assetEqual(t, "Close Error", nil, cache.Close())
+	assetEqual(t, "Close Error", nil, cache.Close())
+
+	cache = NewMemoryCache(false)
+	assetEqual(t, "Close Error", nil, cache.Close())
+	assetEqual(t, "Close Error", nil, cache.Close())
+}
+
+func TestClosedPut(t *testing.T) {
+	cache := NewMemoryCache(true)
+	cache.PutP("a", 1)
+	cache.Close()
+
+	assetEqual(t, "PutE Error", ErrClosed, cache.PutE("b", 2, time.Minute, AbsoluteExpiration))
+	assetEqual(t, "AddE Error", ErrClosed, cache.AddE("b", 2, time.Minute, AbsoluteExpiration))
+
+	func() {
+		defer func() {
+			assetEqual(t, "Put Error: panic", ErrClosed, recover())
+		}()
+		cache.PutP("b", 2)
+	}()
+
+	assetGet(t, cache, "a", 1)
+	assetEqual(t, "Update Error", true, cache.Update("a", 2))
+	cache.Delete("a")
+	assetEqual(t, "Count Error", 0, cache.Count())
+
+	v, err := cache.GetOrCompute("c", time.Minute, AbsoluteExpiration, func() (interface{}, error) {
+		return 3, nil
+	})
+	assetEqual(t, "GetOrCompute Error", nil, err)
+	assetEqual(t, "GetOrCompute Error", 3, v)
+	assetEqual(t, "Exists Error: c", false, cache.Exists("c"))
+}
+
+func TestFinalizerKeepsCacheOpen(t *testing.T) {
+	put := NewMemoryCache(true).Put
+	for i := 0; i < 3; i++ {
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+	}
+
+	put("k", 1, time.Minute, AbsoluteExpiration)
+
+	cache := NewMemoryCache(true)
+	stopTick(cache)
+	cache.PutP("a", 1)
+	assetGet(t, cache, "a", 1)
+}
+
+func TestStopTick(t *testing.T) {
+	cache := NewMemoryCache(false)
+	assetEqual(t, "IsExpiring Error", false, cache.IsExpiring())
+
+	done := make(chan struct{})
+	go func() {
+		stopTick(cache)
+		stopTick(cache)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("stopTick Error: blocked without the goroutine of expire")
+	}
+
+	cache = NewMemoryCache(true)
+	assetEqual(t, "IsExpiring Error", true, cache.IsExpiring())
+	cache.Close()
+	assetEqual(t, "IsExpiring Error", false, cache.IsExpiring())
+}
+
+func TestMaxBytes(t *testing.T) {
+	cache := New(WithMaxBytes(10), WithSizer(func(value interface{}) int64 {
+		return int64(len(value.(string)))
+	}))
+
+	cache.PutP("a", "1234")
+	cache.PutP("b", "1234")
+	assetEqual(t, "Bytes Error", int64(8), cache.Bytes())
+
+	cache.PutP("c", "12")
+	assetEqual(t, "Bytes Error", int64(10), cache.Bytes())
+	assetEqual(t, "Count Error", 3, cache.Count())
+
+	cache.Update("c", "123")
+	assetEqual(t, "Bytes Error", int64(7), cache.Bytes())
+	assetEqual(t, "Exists Error: a", false, cache.Exists("a"))
+
+	cache.PutP("d", "123456789012")
+	assetEqual(t, "Bytes Error", int64(12), cache.Bytes())
+	assetEqual(t, "Count Error", 1, cache.Count())
+
+	cache.Delete("d")
+	assetEqual(t, "Bytes Error", int64(0), cache.Bytes())
+}
+
+func TestMemoryPressure(t *testing.T) {
+	cache := New(WithMemoryPressureEviction(1))
+	defer cache.Close()
+
+	for i := 0; i < 20; i++ {
+		cache.PutP(strconv.Itoa(i), i)
+	}
+	cache.Get("0")
+
+	assetEqual(t, "relievePressure Error", 2, cache.relievePressure())
+	assetEqual(t, "Count Error", 18, cache.Count())
+	assetEqual(t, "Exists Error: 0", true, cache.Exists("0"))
+	assetEqual(t, "Exists Error: 1", false, cache.Exists("1"))
+
+	cache = New(WithMemoryPressureEviction(1 << 62))
+	defer cache.Close()
+	cache.PutP("a", 1)
+	assetEqual(t, "relievePressure Error", 0, cache.relievePressure())
+}
+
+func TestMaxValueSize(t *testing.T) {
+	cache := New(WithMaxValueSize(4), WithSizer(func(value interface{}) int64 {
+		return int64(len(value.(string)))
+	}))
+
+	assetEqual(t, "PutE Error", nil, cache.PutE("a", "1234", time.Minute, AbsoluteExpiration))
+	assetEqual(t, "PutE Error", ErrValueTooLarge, cache.PutE("a", "12345", time.Minute, AbsoluteExpiration))
+	assetGet(t, cache, "a", "1234")
+
+	cache.PutP("b", "12345")
+	assetEqual(t, "Exists Error: b", false, cache.Exists("b"))
+
+	assetEqual(t, "UpdateE Error", ErrValueTooLarge, cache.UpdateE("a", "12345"))
+	assetEqual(t, "Update Error", false, cache.Update("a", "12345"))
+	assetGet(t, cache, "a", "1234")
+
+	assetEqual(t, "Replace Error", false, cache.Replace("a", "12345", time.Minute, AbsoluteExpiration))
+	assetGet(t, cache, "a", "1234")
+
+	assetEqual(t, "UpdateExp Error", false, cache.UpdateExp("a", "12345", time.Minute))
+	assetGet(t, cache, "a", "1234")
+
+	previous, loaded := cache.Swap("a", "12345")
+	assetEqual(t, "Swap Error", nil, previous)
+	assetEqual(t, "Swap Error", false, loaded)
+	assetGet(t, cache, "a", "1234")
+
+	previous, loaded = cache.GetAndSet("a", "12345", time.Minute, AbsoluteExpiration)
+	assetEqual(t, "GetAndSet Error", nil, previous)
+	assetEqual(t, "GetAndSet Error", false, loaded)
+	assetGet(t, cache, "a", "1234")
+
+	cache.WithLock("a", func(interface{}, bool) (interface{}, bool) { return "12345", true })
+	assetGet(t, cache, "a", "1234")
+}
+
+func TestCodec(t *testing.T) {
+	cache := NewMemoryCache(false)
+	assetEqual(t, "PutEncoded Error", nil, cache.PutEncoded("a", map[string]int{"x": 1}, time.Minute, AbsoluteExpiration))
+
+	v, err := cache.GetDecoded("a")
+	assetEqual(t, "GetDecoded Error", nil, err)
+	assetEqual(t, "GetDecoded Error", float64(1), v.(map[string]interface{})["x"])
+
+	_, err = cache.GetDecoded("b")
+	assetEqual(t, "GetDecoded Error", ErrKeyNotFound, err)
+
+	cache = New(WithCodec(func(v interface{}) ([]byte, error) {
+		return []byte(strconv.Itoa(v.(int))), nil
+	}, func(b []byte) (interface{}, error) {
+		return strconv.Atoi(string(b))
+	}))
+	cache.PutEncoded("a", 42, time.Minute, AbsoluteExpiration)
+	b, _ := cache.GetBytes("a")
+	assetEqual(t, "GetBytes Error", "42", string(b))
+	v, _ = cache.GetDecoded("a")
+	assetEqual(t, "GetDecoded Error", 42, v)
+}
+
+func TestLockStats(t *testing.T) {
+	cache := New(WithContentionTracking())
+	cache.PutP("a", 1)
+	cache.Get("a")
+
+	_, _, reads, writes := cache.LockStats()
+	if reads == 0 || writes == 0 {
+		t.Error("LockStats Error, locks not counted:", reads, writes)
+	}
+
+	cache.Lock()
+	done := make(chan struct{})
+	go func() {
+		cache.Get("a")
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cache.Unlock()
+	<-done
+
+	if readWait, _, _, _ := cache.LockStats(); readWait < 5*time.Millisecond {
+		t.Error("LockStats Error, read wait not recorded:", readWait)
+	}
+
+	_, _, reads, _ = cache.LockStats()
+	cache.TryGet("a")
+	_, _, after, _ := cache.LockStats()
+	assetEqual(t, "LockStats Error: TryGet", reads+1, after)
+
+	_, _, reads, _ = NewMemoryCache(false).LockStats()
+	assetEqual(t, "LockStats Error: off", uint64(0), reads)
+}
+
+func TestTryGet(t *testing.T) {
+	cache := NewMemoryCache(false)
+	cache.PutP("a", 1)
+
+	v, ok, locked := cache.TryGet("a")
+	assetEqual(t, "TryGet Error: a", true, locked)
+	assetEqual(t, "TryGet Error: a", true, ok)
+	assetEqual(t, "TryGet Error: a", 1, v)
+
+	_, ok, locked = cache.TryGet("b")
+	assetEqual(t, "TryGet Error: b", true, locked)
+	assetEqual(t, "TryGet Error: b", false, ok)
+
+	cache.Lock()
+	_, ok, locked = cache.TryGet("a")
+	cache.Unlock()
+	assetEqual(t, "TryGet Error: locked", false, locked)
+	assetEqual(t, "TryGet Error: locked", false, ok)
+}
+
+func TestWriteThrough(t *testing.T) {
+	fail := errors.New("store down")
+	store := make(map[string]interface{})
+	write := func(key string, value interface{}) error {
+		if value == "bad" {
+			return fail
+		}
+		store[key] = value
+		return nil
+	}
+
+	lazy := New(WithWriteThrough(write, WriteThroughLazy))
+	lazy.PutP("a", 1)
+	lazy.Update("a", 2)
+	assetEqual(t, "WriteThrough Error: a", 2, store["a"])
+	assetEqual(t, "WriteThrough Error: lazy", fail, lazy.PutE("b", "bad", NoExpiration, AbsoluteExpiration))
+	assetGet(t, lazy, "b", "bad")
+
+	strict := New(WithWriteThrough(write, WriteThroughStrict))
+	strict.PutP("a", 1)
+	assetEqual(t, "WriteThrough Error: strict", fail, strict.UpdateE("a", "bad"))
+	assetEqual(t, "WriteThrough Error: strict", false, strict.Exists("a"))
+	strict.Put("b", "bad", time.Minute, AbsoluteExpiration)
+	assetEqual(t, "WriteThrough Error: strict", false, strict.Exists("b"))
+}
+
+func TestWriteThroughStores(t *testing.T) {
+	store := make(map[string]interface{})
+	write := func(key string, value interface{}) error {
+		store[key] = value
+		return nil
+	}
+
+	cache := New(WithWriteThrough(write, WriteThroughLazy))
+	cache.PutMulti(map[string]interface{}{"multi": 1}, time.Minute, AbsoluteExpiration)
+	cache.PutWithMeta("meta", 1, nil, time.Minute, AbsoluteExpiration)
+	cache.PutIdle("idle", 1, time.Minute, time.Second)
+	cache.Add("add", 1, time.Minute, AbsoluteExpiration)
+	cache.LoadOrStore("load", 1, time.Minute, AbsoluteExpiration)
+	cache.GetOrPut("getorput", 1, time.Minute, AbsoluteExpiration)
+	cache.Swap("swap", 1)
+	cache.GetAndSet("getandset", 1, time.Minute, AbsoluteExpiration)
+	cache.PutIf("putif", 1, nil, time.Minute, AbsoluteExpiration)
+	cache.Replace("swap", 2, time.Minute, AbsoluteExpiration)
+	cache.UpdateExp("meta", 2, time.Minute)
+	cache.Increment("add", 2)
+	cache.WithLock("lock", func(interface{}, bool) (interface{}, bool) { return 1, true })
+	cache.GetOrCompute("compute", time.Minute, AbsoluteExpiration, func() (interface{}, error) { return 1, nil })
+	cache.PutP("old", 1)
+	cache.Rename("old", "renamed")
+
+	want := map[string]interface{}{
+		"multi": 1, "meta": 2, "idle": 1, "add": 3, "load": 1, "getorput": 1, "swap": 2,
+		"getandset": 1, "putif": 1, "lock": 1, "compute": 1, "renamed": 1,
+	}
+	for k, v := range want {
+		assetEqual(t, "WriteThrough Error: "+k, v, store[k])
+	}
+
+	var buf strings.Builder
+	cache.DumpJSON(&buf)
+	store = make(map[string]interface{})
+	cache.Clear()
+	cache.LoadJSON(strings.NewReader(buf.String()))
+	assetEqual(t, "WriteThrough Error: restored", len(want), cache.Count())
+	assetEqual(t, "WriteThrough Error: restored", 0, len(store))
+}
+
+func TestClone(t *testing.T) {
+	clock := NewFakeClock()
+	cache := New(WithClock(clock), WithMaxEntries(3))
+	cache.PutP("a", 1)
+	cache.PutP("b", 2)
+	cache.PutAbs("c", 3, time.Second)
+	cache.Update("b", 20)
+	cache.Get("a")
+
+	clock.Advance(2 * time.Second)
+	clone := cache.Clone()
+	assetEqual(t, "Clone Error: count", 2, clone.Count())
+	assetGet(t, clone, "b", 20)
+
+	clone.Delete("a")
+	clone.PutP("d", 4)
+	assetEqual(t, "Clone Error: a", true, cache.Exists("a"))
+	assetEqual(t, "Clone Error: d", false, cache.Exists("d"))
+
+	e, _ := clone.Describe("b")
+	assetEqual(t, "Clone Error: version", int64(1), e.Version)
+
+	clone.PutP("e", 5)
+	clone.PutP("f", 6)
+	assetEqual(t, "Clone Error: count", 3, clone.Count())
+	assetEqual(t, "Clone Error: b", false, clone.Exists("b"))
+}
+
+func TestMerge(t *testing.T) {
+	a := NewMemoryCache(false)
+	a.PutP("x", 1)
+	a.PutAbs("y", 1, time.Minute)
+
+	b := NewMemoryCache(false)
+	b.PutP("x", 2)
+	b.PutAbs("y", 2, time.Hour)
+	b.PutP("z", 2)
+
+	a.Merge(b, nil)
+	assetGet(t, a, "x", 1)
+	assetGet(t, a, "z", 2)
+
+	a.Merge(b, func(key string, x, y interface{}) interface{} {
+		return x.(int) + y.(int)
+	})
+	assetGet(t, a, "x", 3)
+	assetGet(t, a, "y", 3)
+
+	c := NewMemoryCache(false)
+	c.PutAbs("y", 1, time.Minute)
+	c.MergeLatest(b)
+	assetGet(t, c, "y", 2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		go func() { defer wg.Done(); a.Merge(b, nil) }()
+		go func() { defer wg.Done(); b.Merge(a, nil) }()
+	}
+	wg.Wait()
+}
+
+func TestMergeCopy(t *testing.T) {
+	copier := WithCopyOnGet(func(v interface{}) interface{} { return v.(int) + 100 })
+	a := New(copier)
+	a.PutP("x", 1)
+	b := New(copier)
+	b.PutP("x", 2)
+
+	a.Merge(b, func(key string, x, y interface{}) interface{} {
+		assetEqual(t, "Merge Error: a", 101, x)
+		assetEqual(t, "Merge Error: b", 102, y)
+		return 3
+	})
+	assetGet(t, a, "x", 103)
+}
+
+func TestNextExpiration(t *testing.T) {
+	clock := NewFakeClock()
+	cache := NewMemoryCacheWithClock(clock, false)
+
+	_, _, ok := cache.NextExpiration()
+	assetEqual(t, "NextExpiration Error: empty", false, ok)
+
+	cache.PutP("a", 1)
+	cache.PutAbs("b", 2, time.Hour)
+	cache.PutSlid("c", 3, time.Minute)
+
+	key, at, _ := cache.NextExpiration()
+	assetEqual(t, "NextExpiration Error: key", "c", key)
+	assetEqual(t, "NextExpiration Error: at", clock.Now().Add(time.Minute), at)
+
+	clock.Advance(30 * time.Second)
+	cache.Get("c")
+	key, at, _ = cache.NextExpiration()
+	assetEqual(t, "NextExpiration Error: key", "c", key)
+	assetEqual(t, "NextExpiration Error: at", clock.Now().Add(time.Minute), at)
+
+	cache.Delete("c")
+	key, _, _ = cache.NextExpiration()
+	assetEqual(t, "NextExpiration Error: key", "b", key)
+}
+
+func TestStrictExpiration(t *testing.T) {
+	clock := NewFakeClock()
+	cache := New(WithClock(clock))
+	cache.PutAbs("a", 1, 0)
+	clock.Advance(time.Second)
+	assetEqual(t, "Expiration Error: default", true, cache.Exists("a"))
+
+	strict := New(WithClock(clock), WithStrictExpiration())
+	strict.PutAbs("a", 1, 0)
+	strict.PutAbs("b", 2, NoExpiration)
+	strict.Set("c", 3)
+	clock.Advance(time.Second)
+	assetEqual(t, "Expiration Error: strict a", false, strict.Exists("a"))
+	assetEqual(t, "Expiration Error: strict b", true, strict.Exists("b"))
+	assetEqual(t, "Expiration Error: strict c", true, strict.Exists("c"))
+
+	min := New(WithClock(clock), WithMinExpiration(time.Minute))
+	min.PutAbs("a", 1, time.Second)
+	min.PutP("b", 2)
+	clock.Advance(30 * time.Second)
+	assetEqual(t, "Expiration Error: min a", true, min.Exists("a"))
+	clock.Advance(time.Minute)
+	assetEqual(t, "Expiration Error: min a", false, min.Exists("a"))
+	assetEqual(t, "Expiration Error: min b", true, min.Exists("b"))
+}
+
+func TestPutBytes(t *testing.T) {
+	cache := New(WithMaxBytes(10))
+
+	cache.PutBytes("a", []byte("1234"), time.Minute, AbsoluteExpiration)
+	cache.PutBytes("b", []byte("1234"), time.Minute, AbsoluteExpiration)
+	cache.PutP("c", "not bytes")
+	assetEqual(t, "Bytes Error", int64(8), cache.Bytes())
+
+	b, ok := cache.GetBytes("a")
+	assetEqual(t, "GetBytes Error: a", true, ok)
+	assetEqual(t, "GetBytes Error: a", "1234", string(b))
+
+	_, ok = cache.GetBytes("c")
+	assetEqual(t, "GetBytes Error: c", false, ok)
+
+	cache.PutBytes("d", []byte("1234"), time.Minute, AbsoluteExpiration)
+	assetEqual(t, "Bytes Error", int64(8), cache.Bytes())
+	assetEqual(t, "Exists Error: b", false, cache.Exists("b"))
+}
+
+func TestStatN(t *testing.T) {
+	cache := New(WithStatRedactor(func(key string, value interface{}) string {
+		if key == "password" {
+			return "***"
+		}
+		return fmt.Sprint(value)
+	}))
+	cache.PutP("password", "hunter2")
+
+	stat := cache.Stat()
+	assetEqual(t, "Stat Error: redacted", false, strings.Contains(stat, "hunter2"))
+	assetEqual(t, "Stat Error: redacted", true, strings.Contains(stat, "value=***"))
+
+	for i := 0; i < 200; i++ {
+		cache.PutP(strconv.Itoa(i), i)
+	}
+	assetEqual(t, "Stat Error: limit", _statLimit, strings.Count(cache.Stat(), "key="))
+	assetEqual(t, "StatN Error: limit", 5, strings.Count(cache.StatN(5), "key="))
+	assetEqual(t, "StatN Error: more", true, strings.Contains(cache.StatN(5), "... 196 more"))
+}
+
+func TestStats(t *testing.T) {
+	cache := NewMemoryCacheLRU(1, true)
+
+	cache.PutP("a", 1)
+	cache.Get("a")
+	cache.Get("b")
+	cache.PutAbs("c", 3, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	cache.Get("c")
+
+	assetEqual(t, "Stats Error", CacheStats{Hits: 1, Misses: 2, Evictions: 2}, cache.Stats())
+
+	cache.ResetStats()
+	assetEqual(t, "Stats Error", CacheStats{}, cache.Stats())
+}
+
+type countingSink struct {
+	hits, misses, evictions, size int
+}
+
+func (s *countingSink) AddHits(n int)      { s.hits += n }
+func (s *countingSink) AddMisses(n int)    { s.misses += n }
+func (s *countingSink) AddEvictions(n int) { s.evictions += n }
+func (s *countingSink) SetSize(n int)      { s.size = n }
+
+func TestMetrics(t *testing.T) {
+	sink := &countingSink{}
+	cache := New(WithMaxEntries(1), WithMetrics(sink))
+
+	cache.PutP("a", 1)
+	cache.Get("a")
+	cache.Get("b")
+	cache.PutAbs("c", 3, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	cache.Get("c")
+
+	assetEqual(t, "Metrics Error", countingSink{hits: 1, misses: 2, evictions: 2}, *sink)
+
+	cache.PutP("d", 4)
+	assetEqual(t, "Metrics Error", 1, sink.size)
+}
+
+// reentrantSink reads the cache it is wired to from every method
+type reentrantSink struct {
+	cache *MCache
+	calls []string
+}
+
+func (s *reentrantSink) AddHits(n int)      { s.record("hits", n) }
+func (s *reentrantSink) AddMisses(n int)    { s.record("misses", n) }
+func (s *reentrantSink) AddEvictions(n int) { s.record("evictions", n) }
+func (s *reentrantSink) SetSize(n int)      {}
+
+func (s *reentrantSink) record(name string, n int) {
+	s.cache.Count()
+	s.calls = append(s.calls, name+"="+strconv.Itoa(n))
+}
+
+func TestMetricsOutsideLock(t *testing.T) {
+	clock := NewFakeClock()
+	sink := &reentrantSink{}
+	cache := New(WithClock(clock), WithMetrics(sink))
+	sink.cache = cache
+
+	cache.PutAbs("a", 1, time.Second)
+	cache.PutAbs("b", 2, time.Second)
+	cache.GetMulti([]string{"a", "b", "c"})
+	clock.Advance(2 * time.Second)
+	cache.Recycle()
+
+	assetEqual(t, "Metrics Error", "hits=2 misses=1 evictions=2", strings.Join(sink.calls, " "))
+}
+
+func TestGeneration(t *testing.T) {
+	clock := NewFakeClock()
+	cache := NewMemoryCacheWithClock(clock, false)
+
+	gen := cache.Generation()
+	cache.Get("a")
+	assetEqual(t, "Generation Error", gen, cache.Generation())
+
+	for _, fn := range []func(){
+		func() { cache.PutAbs("a", 1, time.Minute) },
+		func() { cache.Update("a", 2) },
+		func() { cache.Delete("a") },
+		func() { cache.Clear() },
+		func() {
+			cache.PutAbs("b", 1, time.Minute)
+			clock.Advance(2 * time.Minute)
+			gen = cache.Generation()
+			cache.Recycle()
+		},
+	} {
+		fn()
+		if cache.Generation() == gen {
+			t.Error("Generation Error, not changed")
+		}
+		gen = cache.Generation()
+	}
+}
+
+func TestExpireClock(t *testing.T) {
+	clock := NewFakeClock()
+	cache := NewMemoryCacheWithClock(clock, false)
+
+	cache.PutAbs("a", 1, 2*time.Minute)
+	cache.PutSlid("b", 1, 2*time.Minute)
+	cache.PutP("c", 1)
+
+	for i := 0; i < 3; i++ {
+		clock.Advance(time.Minute)
+		cache.Get("b")
+	}
+	assetEqual(t, "Exists Error: a", false, cache.Exists("a"))
+	assetEqual(t, "Exists Error: b", true, cache.Exists("b"))
+
+	clock.Advance(3 * time.Minute)
+	assetEqual(t, "Exists Error: b", false, cache.Exists("b"))
+	assetEqual(t, "Exists Error: c", true, cache.Exists("c"))
+}
+
+func TestSweep(t *testing.T) {
+	for _, opt := range []Option{WithLinearSweep(), WithTimingWheel(), func(*mcache) {}} {
+		clock := NewFakeClock()
+		cache := New(WithClock(clock), opt)
+		cache.PutAbs("a", 1, time.Minute)
+		cache.PutSlid("b", 1, time.Minute)
+		cache.PutIdle("c", 1, 0, time.Minute)
+		cache.PutAbs("d", 1, time.Hour)
+		cache.PutP("e", 1)
+
+		clock.Advance(50 * time.Second)
+		cache.Get("b")
+		cache.Touch("d", 30*time.Second)
+
+		clock.Advance(20 * time.Second)
+		assetEqual(t, "DeleteExpired Error", 2, cache.DeleteExpired())
+		assetEqual(t, "Exists Error: b", true, cache.Exists("b"))
+
+		clock.Advance(20 * time.Second)
+		assetEqual(t, "DeleteExpired Error", 1, cache.DeleteExpired())
+		assetEqual(t, "Count Error", 2, cache.Count())
+
+		if at, ok := cache.sweeper.next(); ok {
+			due := clock.Now().Add(20 * time.Second)
+			if _, wheel := cache.sweeper.(*wheelSweep); wheel {
+				due = time.Unix(due.Unix()+1, 0)
+			}
+			assetEqual(t, "next Error", due, at)
+		}
+	}
+}
+
+func TestExpireHandler(t *testing.T) {
+	clock := NewFakeClock()
+	flushed := map[string]int{}
+	fail := true
+	cache := New(WithClock(clock), WithExpireHandler(func(key string, value interface{}) bool {
+		if key == "b" && fail {
+			return true
+		}
+		flushed[key] = value.(int)
+		return false
+	}))
+
+	cache.PutAbs("a", 1, time.Minute)
+	cache.PutAbs("b", 2, time.Minute)
+	cache.PutP("c", 3)
+	clock.Advance(2 * time.Minute)
+
+	assetEqual(t, "Exists Error: a", false, cache.Exists("a"))
+	cache.Recycle()
+	assetEqual(t, "ExpireHandler Error: a", 1, flushed["a"])
+	assetEqual(t, "Count Error", 2, cache.Count())
+
+	fail = false
+	cache.Recycle()
+	assetEqual(t, "ExpireHandler Error: b", 2, flushed["b"])
+	assetEqual(t, "Count Error", 1, cache.Count())
+	assetEqual(t, "ExpireHandler Error", 2, len(flushed))
+}
+
+func TestNextTick(t *testing.T) {
+	clock := NewFakeClock()
+	cache := New(WithClock(clock), WithTickInterval(time.Minute))
+	assetEqual(t, "nextTick Error", time.Minute, cache.nextTick())
+
+	cache.PutAbs("a", 1, 10*time.Second)
+	assetEqual(t, "nextTick Error", 10*time.Second, cache.nextTick())
+
+	cache.PutAbs("b", 1, time.Millisecond)
+	assetEqual(t, "nextTick Error", _minTickInterval, cache.nextTick())
+
+	cache = New(WithClock(clock), WithTickInterval(time.Minute), WithTickJitter(time.Minute), WithSeed(1))
+	for i := 0; i < 10; i++ {
+		d := cache.nextTick()
+		if d < time.Minute || d >= 2*time.Minute {
+			t.Error("nextTick Error, jitter out of range:", d)
+		}
+	}
+}
+
+func TestNoExpiration(t *testing.T) {
+	clock := NewFakeClock()
+	cache := NewMemoryCacheWithClock(clock, false)
+
+	cache.PutP("a", 1)
+	cache.PutSlid("b", 1, 0)
+	cache.PutAbs("c", 1, NoExpiration)
+	assetEqual(t, "sweep Error", 0, len(cache.sweeper.(*heapSweep).h))
+
+	clock.Advance(2000 * 1000 * time.Hour)
+	cache.Recycle()
+	assetEqual(t, "Count Error", 3, cache.Count())
+
+	assetGet(t, cache, "a", 1)
+	assetGet(t, cache, "b", 1)
+	assetEqual(t, "Add Error: a", false, cache.Add("a", 2, time.Minute, AbsoluteExpiration))
+
+	_, at, _ := cache.GetWithExpiry("a")
+	assetEqual(t, "GetWithExpiry Error: a", time.Time{}, at)
+}
+
+func TestMaxTTL(t *testing.T) {
+	clock := NewFakeClock()
+	cache := New(WithClock(clock), WithMaxTTL(time.Minute))
+
+	cache.PutP("a", 1)
+	cache.PutAbs("b", 1, time.Hour)
+	cache.PutAbs("c", 1, 30*time.Second)
+	cache.PutAbs("d", 1, 30*time.Second)
+	cache.Touch("d", time.Hour)
+
+	_, at, _ := cache.GetWithExpiry("a")
+	assetEqual(t, "GetWithExpiry Error: a", clock.Now().Add(time.Minute), at)
+
+	clock.Advance(45 * time.Second)
+	assetEqual(t, "Exists Error: c", false, cache.Exists("c"))
+	assetEqual(t, "Count Error", 3, cache.CountValid())
+
+	clock.Advance(30 * time.Second)
+	assetEqual(t, "Count Error", 0, cache.CountValid())
+}
+
+func TestPutMultiJittered(t *testing.T) {
+	clock := NewFakeClock()
+	cache := New(WithClock(clock), WithSeed(1))
+
+	entries := map[string]interface{}{}
+	for i := 0; i < 100; i++ {
+		entries[strconv.Itoa(i)] = i
+	}
+	cache.PutMultiJittered(entries, time.Minute, time.Minute, AbsoluteExpiration)
+
+	distinct := map[time.Time]bool{}
+	for _, info := range cache.Snapshot() {
+		if info.ExpiresAt.Before(clock.Now().Add(time.Minute)) || !info.ExpiresAt.Before(clock.Now().Add(2*time.Minute)) {
+			t.Error("PutMultiJittered Error, expiration out of range:", info.Key, info.ExpiresAt)
+		}
+		distinct[info.ExpiresAt] = true
+	}
+	assetEqual(t, "PutMultiJittered Error", true, len(distinct) > 1)
+
+	clock.Advance(90 * time.Second)
+	n := cache.CountValid()
+	assetEqual(t, "PutMultiJittered Error", true, n > 0 && n < 100)
+}
+
+func TestMaxIdle(t *testing.T) {
+	clock := NewFakeClock()
+	cache := NewMemoryCacheWithClock(clock, false)
+
+	cache.PutIdle("a", 1, 5*time.Minute, 2*time.Minute)
+	cache.PutIdle("b", 1, 0, 2*time.Minute)
+
+	for i := 0; i < 4; i++ {
+		clock.Advance(time.Minute)
+		cache.Get("a")
+		cache.Get("b")
+	}
+	assetEqual(t, "Exists Error: a", true, cache.Exists("a"))
+
+	_, at, _ := cache.GetWithExpiry("a")
+	assetEqual(t, "GetWithExpiry Error: a", clock.Now().Add(time.Minute), at)
+
+	clock.Advance(90 * time.Second)
+	assetEqual(t, "Exists Error: a", false, cache.Exists("a"))
+	assetEqual(t, "Exists Error: b", true, cache.Exists("b"))
+
+	clock.Advance(time.Minute)
+	assetEqual(t, "Exists Error: b", false, cache.Exists("b"))
+}
+
+func TestPutNil(t *testing.T) {
+	clock := NewFakeClock()
+	cache := NewMemoryCacheWithClock(clock, false)
+
+	cache.PutNil("a", time.Minute)
+	cache.PutP("b", nil)
+
+	v, ok := cache.Get("a")
+	assetEqual(t, "Get Error: a", true, ok)
+	assetEqual(t, "Get Error: a", true, v == Negative)
+
+	v, ok = cache.Get("b")
+	assetEqual(t, "Get Error: b", true, ok)
+	assetEqual(t, "Get Error: b", false, v == Negative)
+
+	clock.Advance(2 * time.Minute)
+	_, ok = cache.Get("a")
+	assetEqual(t, "Get Error: a", false, ok)
+}
+
+// time.now() take time
+func BenchmarkGet(b *testing.B) {
+	var key = "a"
+	b.StopTimer()
+	cache := NewMemoryCache(true)
+	cache.PutP(key, key)
+	b.StartTimer()
+
+	for i := 0; i < b.N; i++ {
+		cache.Get(key)
+	}
+}
+
+func BenchmarkGetM(b *testing.B) {
+	var key = "key"
+	count := 1000 * 1000
+	b.StopTimer()
+	cache := NewMemoryCache(true)
+	for i := 0; i < count; i++ {
+		cache.PutP(strconv.Itoa(i)+key, i)
+	}
+	key = "1000key"
+	b.StartTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, _ = cache.Get(key)
+	}
+}
+
+// fillExpired fill cache with count entries, every tenth of them expired
+func fillExpired(cache *MCache, clock *FakeClock, count int) {
+	for i := 0; i < count; i++ {
+		if i%10 == 0 {
+			cache.PutAbs(strconv.Itoa(i), i, time.Minute)
+		} else {
+			cache.PutAbs(strconv.Itoa(i), i, time.Hour)
+		}
+	}
+	clock.Advance(2 * time.Minute)
+}
+
+func BenchmarkGetOrPut(b *testing.B) {
+	cache := NewMemoryCache(false)
+	cache.PutP("a", 1)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		cache.GetOrPut("a", 1, time.Minute, AbsoluteExpiration)
+	}
+}
+
+func BenchmarkLoadOrStore(b *testing.B) {
+	cache := NewMemoryCache(false)
+	cache.PutP("a", 1)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		cache.LoadOrStore("a", 1, time.Minute, AbsoluteExpiration)
+	}
+}
+
+func BenchmarkGetOrPutParallel(b *testing.B) {
+	cache := NewMemoryCache(false)
+	cache.PutP("a", 1)
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			cache.GetOrPut("a", 1, time.Minute, AbsoluteExpiration)
+		}
+	})
+}
+
+func BenchmarkLoadOrStoreParallel(b *testing.B) {
+	cache := NewMemoryCache(false)
+	cache.PutP("a", 1)
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			cache.LoadOrStore("a", 1, time.Minute, AbsoluteExpiration)
+		}
+	})
+}
+
+func BenchmarkRecycle(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		clock := NewFakeClock()
+		cache := NewMemoryCacheWithClock(clock, false)
+		fillExpired(cache, clock, 1000*1000)
+		b.StartTimer()
+
+		cache.recycle()
+	}
+}
+
+func BenchmarkRecycleLinear(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		clock := NewFakeClock()
+		cache := New(WithClock(clock), WithLinearSweep())
+		fillExpired(cache, clock, 1000*1000)
+		b.StartTimer()
+
+		cache.recycle()
+	}
+}
+
+func BenchmarkRecycleWheel(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		clock := NewFakeClock()
+		cache := New(WithClock(clock), WithTimingWheel())
+		fillExpired(cache, clock, 1000*1000)
+		b.StartTimer()
+
+		cache.recycle()
+	}
+}
+
+// BenchmarkRecycleTwoPhase is the former recycle: collect expired keys under the read lock,
+// then delete them under the write lock
+func BenchmarkRecycleTwoPhase(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		clock := NewFakeClock()
+		cache := NewMemoryCacheWithClock(clock, false)
+		fillExpired(cache, clock, 1000*1000)
+		b.StartTimer()
+
+		var keys []string
+		cache.RLock()
+		now := cache.now()
+		for k, v := range cache.items {
+			if v.expired(now) {
+				keys = append(keys, k)
+			}
+		}
+		cache.RUnlock()
+		cache.deleteMulti(keys, EvictReasonExpired)
 	}
 }
 
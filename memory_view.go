@@ -0,0 +1,43 @@
+// Copyright 2013 by sdm. All rights reserved.
+
+package mcache
+
+// ReadableCache is the read-only part of the cache API
+type ReadableCache interface {
+	Get(key string) (interface{}, bool)
+	GetV(key string) (interface{}, int, bool)
+	Exists(key string) bool
+	Keys() []string
+	Count() int
+}
+
+// readOnly restrict a cache to ReadableCache, it can't be type asserted back to a writable cache
+type readOnly struct {
+	mc *mcache
+}
+
+// ReadOnly return a read-only view of the cache. It is a view, not a copy,
+// so its content still changes with writes to the cache
+func (mc *mcache) ReadOnly() ReadableCache {
+	return readOnly{mc}
+}
+
+func (r readOnly) Get(key string) (interface{}, bool) {
+	return r.mc.Get(key)
+}
+
+func (r readOnly) GetV(key string) (interface{}, int, bool) {
+	return r.mc.GetV(key)
+}
+
+func (r readOnly) Exists(key string) bool {
+	return r.mc.Exists(key)
+}
+
+func (r readOnly) Keys() []string {
+	return r.mc.Keys()
+}
+
+func (r readOnly) Count() int {
+	return r.mc.Count()
+}
@@ -0,0 +1,119 @@
+// Copyright 2013 by sdm. All rights reserved.
+
+package mcache
+
+import (
+	"container/heap"
+	"time"
+)
+
+// wheelSweep keep expirable cache entries in buckets by the second of their deadline, a timing
+// wheel, so a sweep only visits the buckets whose second has passed. Touched sliding and idle
+// entries move to the bucket of their new deadline. Entries are removed by the sweep up to one
+// second after they expire, Get still never return them. It is selected by WithTimingWheel.
+// A bucket emptied by unschedule is kept until its second passes, so each second is in the heap once
+type wheelSweep struct {
+	buckets map[int64]map[*item]struct{}
+	seconds secondHeap
+}
+
+func newWheelSweep() *wheelSweep {
+	return &wheelSweep{buckets: map[int64]map[*item]struct{}{}}
+}
+
+func (s *wheelSweep) schedule(x *item) {
+	s.unschedule(x)
+	if !x.expirable() {
+		return
+	}
+
+	x.due = x.expiresAt()
+	sec := x.due.Unix()
+	b, ok := s.buckets[sec]
+	if !ok {
+		b = map[*item]struct{}{}
+		s.buckets[sec] = b
+		heap.Push(&s.seconds, sec)
+	}
+	b[x] = struct{}{}
+	x.index = 0
+}
+
+func (s *wheelSweep) touched(x *item) {
+	if x.index >= 0 && x.expiresAt().Unix() != x.due.Unix() {
+		s.schedule(x)
+	}
+}
+
+func (s *wheelSweep) unschedule(x *item) {
+	if x.index < 0 {
+		return
+	}
+
+	delete(s.buckets[x.due.Unix()], x)
+	x.index = -1
+}
+
+func (s *wheelSweep) reset() {
+	for _, b := range s.buckets {
+		for x := range b {
+			x.index = -1
+		}
+	}
+	s.buckets = map[int64]map[*item]struct{}{}
+	s.seconds = nil
+}
+
+func (s *wheelSweep) next() (time.Time, bool) {
+	for len(s.seconds) > 0 {
+		sec := s.seconds[0]
+		if len(s.buckets[sec]) > 0 {
+			return time.Unix(sec+1, 0), true
+		}
+		heap.Pop(&s.seconds)
+		delete(s.buckets, sec)
+	}
+
+	return time.Time{}, false
+}
+
+func (s *wheelSweep) expired(mc *mcache, now time.Time) []*item {
+	var xs, later []*item
+	for len(s.seconds) > 0 && s.seconds[0] < now.Unix() {
+		sec := heap.Pop(&s.seconds).(int64)
+		for x := range s.buckets[sec] {
+			x.index = -1
+			if x.expired(now) {
+				xs = append(xs, x)
+			} else {
+				later = append(later, x)
+			}
+		}
+		delete(s.buckets, sec)
+	}
+
+	for _, x := range later {
+		s.schedule(x)
+	}
+
+	return xs
+}
+
+// secondHeap is a min-heap of the seconds of wheel buckets, it implements heap.Interface
+type secondHeap []int64
+
+func (h secondHeap) Len() int           { return len(h) }
+func (h secondHeap) Less(i, j int) bool { return h[i] < h[j] }
+func (h secondHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *secondHeap) Push(v interface{}) {
+	*h = append(*h, v.(int64))
+}
+
+func (h *secondHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	sec := old[n-1]
+	*h = old[:n-1]
+	return sec
+}
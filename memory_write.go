@@ -0,0 +1,53 @@
+// Copyright 2013 by sdm. All rights reserved.
+
+package mcache
+
+// WriteThroughMode is what happens to a cache entry when the write through function set by
+// WithWriteThrough fails
+type WriteThroughMode int
+
+const (
+	// WriteThroughLazy keep the entry in memory and return the error
+	WriteThroughLazy WriteThroughMode = iota
+	// WriteThroughStrict remove the entry from memory and return the error, so the cache never
+	// serves a value the backing store rejected
+	WriteThroughStrict
+)
+
+// pendingWrite is a stored cache entry waiting for the write through function
+type pendingWrite struct {
+	key     string
+	x       *item
+	version int64
+	value   interface{}
+}
+
+// queueWrite record stored cache entry x for the write through function called by unlock,
+// caller must hold the lock
+func (mc *mcache) queueWrite(x *item) {
+	if mc.writeThrough != nil {
+		mc.unwritten = append(mc.unwritten, pendingWrite{x.Key, x, x.Version, x.Value})
+	}
+}
+
+// write pass a stored cache entry to the write through function outside the lock, in strict mode
+// the entry is removed on error unless it was written again meanwhile
+func (mc *mcache) write(key string, x *item, version int64, value interface{}) error {
+	if mc.writeThrough == nil {
+		return nil
+	}
+
+	err := mc.writeThrough(key, value)
+	if err == nil || mc.writeThroughMode != WriteThroughStrict {
+		return err
+	}
+
+	mc.Lock()
+	defer mc.unlock()
+
+	if mc.items[key] == x && x.Version == version {
+		mc.remove(key, x, EvictReasonDeleted)
+	}
+
+	return err
+}